@@ -0,0 +1,13 @@
+package main
+
+import (
+	"log"
+
+	"matiks_app/backend/leaderboard"
+)
+
+func main() {
+	if err := leaderboard.StartServer(); err != nil {
+		log.Fatal(err)
+	}
+}
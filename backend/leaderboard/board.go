@@ -0,0 +1,432 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Leaderboard is the read side of the board that the routes in
+// registerBoardRoutes are written against, so they can be served from a
+// fake in tests or from another backend. *Store is the implementation the
+// server uses; the SSE and WebSocket feeds, exports and routes that mutate
+// the board still take the *Store directly.
+type Leaderboard interface {
+	View() BoardView
+	LeaderboardPage(page int, limit int) []LeaderboardEntry
+	LeaderboardAfter(cursor string, limit int) ([]LeaderboardEntry, string, uint64, error)
+	LeaderboardRange(low int, high int, page int, limit int) ([]LeaderboardEntry, int, int, int)
+	SearchPage(prefix string, page int, limit int) ([]LeaderboardEntry, int, int, int)
+	AppendSearchPage(dst []LeaderboardEntry, prefix string, page int, limit int) ([]LeaderboardEntry, int, int, int)
+	SearchContains(ctx context.Context, substr string, page int, limit int) ([]LeaderboardEntry, int, int, int, bool)
+	SearchFunc(ctx context.Context, prefix string, budget int, fn func(LeaderboardEntry) bool) (int, bool, error)
+	SearchContainsFunc(ctx context.Context, substr string, fn func(LeaderboardEntry) bool) (int, bool, error)
+	FillPercentiles(entries []LeaderboardEntry)
+	FillNeighbors(entries []LeaderboardEntry)
+	CheckConsistency(offset int, limit int, tolerance int) ConsistencyReport
+	Top(n int) []LeaderboardEntry
+	RankRange(from, to int) ([]LeaderboardEntry, int, int)
+	LookupUser(username string) (LeaderboardEntry, float64, bool)
+	PeakRating(username string) (UserPeak, bool)
+	Percentile(username string) (UserPercentile, bool)
+	Compare(a, b string) (CompareResult, error)
+	RanksFor(usernames []string) []UserRank
+	UsersAtRating(rating int, page int, limit int) ([]LeaderboardEntry, int, int)
+	ListByUsername(page int, limit int) ([]LeaderboardEntry, int)
+	UserTier(username string) (UserTier, bool)
+	TierCounts() []TierCount
+	TopMovers(limit int, up bool) []MoverEntry
+	Histogram(bucketCount int) []HistogramBin
+	Stats() Stats
+	UserCount() int
+	RatingBounds() (int, int)
+	LastUpdate() time.Time
+	SnapshotModified() time.Time
+}
+
+// BoardView is one published version of the board. Everything read through
+// the same view agrees, so a page, its ETag and its next cursor never mix
+// two versions. Pages can run in either order; Ascending is the order
+// cursors follow.
+type BoardView interface {
+	Version() uint64
+	Len() int
+	Ascending() bool
+	PageOf(username string, limit int, ascending bool) (int, bool)
+	AppendPage(dst []LeaderboardEntry, page int, limit int, ascending bool) []LeaderboardEntry
+	SetDenseRanks(entries []LeaderboardEntry, page int, limit int, ascending bool)
+	NextCursor(offset int, count int) string
+}
+
+var _ Leaderboard = (*Store)(nil)
+
+// registerBoardRoutes adds the routes that only need the Leaderboard
+// interface.
+func (a *app) registerBoardRoutes(mux *http.ServeMux, board Leaderboard) {
+	mux.HandleFunc("/leaderboard", getOrHead(func(w http.ResponseWriter, r *http.Request) {
+		page, limit, err := pageParams(r, 20, a.maxPageSize)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		fields, err := parseEntryFields(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		includePercentile := getQueryBool(r, "include_percentile", false) || fields&fieldPercentile != 0
+		if notModifiedSince(w, r, board.SnapshotModified()) {
+			return
+		}
+		if after := r.URL.Query().Get("after"); after != "" {
+			entries, next, version, err := board.LeaderboardAfter(after, limit)
+			if errors.Is(err, ErrCursorExpired) {
+				writeError(w, r, http.StatusConflict, err.Error())
+				return
+			}
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			if includePercentile {
+				board.FillPercentiles(entries)
+			}
+			response := LeaderboardCursorResponse{
+				UpdatedAt:  board.LastUpdate().UTC().Format(time.RFC3339),
+				Version:    version,
+				PageSize:   limit,
+				Entries:    entries,
+				NextCursor: next,
+			}
+			if fields != 0 {
+				writeResponse(w, r, http.StatusOK, projectedCursorResponse{response, projectedEntries{entries, fields}})
+				return
+			}
+			writeResponse(w, r, http.StatusOK, response)
+			return
+		}
+
+		if query := r.URL.Query(); query.Has("min") || query.Has("max") {
+			lowest, highest := board.RatingBounds()
+			low := min(max(getQueryInt(r, "min", lowest), lowest), highest)
+			high := min(max(getQueryInt(r, "max", highest), lowest), highest)
+			if low > high {
+				writeError(w, r, http.StatusBadRequest, fmt.Sprintf("min %d must not exceed max %d", low, high))
+				return
+			}
+			entries, total, page, totalPages := board.LeaderboardRange(low, high, page, limit)
+			if entries == nil {
+				entries = []LeaderboardEntry{}
+			}
+			if includePercentile {
+				board.FillPercentiles(entries)
+			}
+			response := LeaderboardRangeResponse{
+				UpdatedAt:  board.LastUpdate().UTC().Format(time.RFC3339),
+				Min:        low,
+				Max:        high,
+				Total:      total,
+				Page:       page,
+				PageSize:   limit,
+				TotalPages: totalPages,
+				Entries:    entries,
+			}
+			if fields != 0 {
+				writeResponse(w, r, http.StatusOK, projectedRangeResponse{response, projectedEntries{entries, fields}})
+				return
+			}
+			writeResponse(w, r, http.StatusOK, response)
+			return
+		}
+
+		order := strings.ToLower(r.URL.Query().Get("order"))
+		if order != "asc" {
+			order = "desc"
+		}
+		ascending := order == "asc"
+		ranking := strings.ToLower(r.URL.Query().Get("ranking"))
+		if ranking != string(RankingDense) {
+			ranking = string(RankingCompetition)
+		}
+
+		view := board.View()
+		if username := r.URL.Query().Get("around_username"); username != "" {
+			containing, ok := view.PageOf(username, limit, ascending)
+			if !ok {
+				writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+				return
+			}
+			page = containing
+		}
+		totalUsers := view.Len()
+		totalPages := calcTotalPages(totalUsers, limit)
+		page = clampPage(page, totalPages)
+
+		// Pages only change when a new snapshot is published, so the snapshot
+		// version plus the page window identify the response.
+		etag := fmt.Sprintf(`W/"lb-%d-%d-%d-%s-%s-%t-%d"`, view.Version(), page, limit, order, ranking, includePercentile, fields)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		pooled := getEntries()
+		defer putEntries(pooled)
+		*pooled = view.AppendPage(*pooled, page, limit, ascending)
+		response := LeaderboardResponse{
+			UpdatedAt:  board.LastUpdate().UTC().Format(time.RFC3339),
+			TotalUsers: totalUsers,
+			Page:       page,
+			PageSize:   limit,
+			TotalPages: totalPages,
+			PageNav:    pageNav(page, totalPages),
+			Entries:    *pooled,
+		}
+		if ranking == string(RankingDense) {
+			view.SetDenseRanks(response.Entries, page, limit, ascending)
+		}
+		if includePercentile {
+			board.FillPercentiles(response.Entries)
+		}
+		if ascending == view.Ascending() {
+			response.NextCursor = view.NextCursor((page-1)*limit, len(response.Entries))
+		}
+		if fields != 0 {
+			writeResponse(w, r, http.StatusOK, projectedLeaderboardResponse{response, projectedEntries{response.Entries, fields}})
+		} else {
+			writeResponse(w, r, http.StatusOK, response)
+		}
+		if a.consistencyCheck && ascending == view.Ascending() {
+			report := board.CheckConsistency((page-1)*limit, limit, a.consistencyTolerance)
+			if len(report.Mismatches) > 0 {
+				first := report.Mismatches[0]
+				a.logger.Warn("rank consistency drift",
+					"mismatches", len(report.Mismatches), "checked", report.Checked, "page", page,
+					"tolerance", report.Tolerance, "max_drift", report.MaxDrift,
+					"username", first.Username, "snapshot_rank", first.SnapshotRank, "live_rank", first.LiveRank)
+			}
+		}
+	}))
+	searchGet := getOrHead(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		if query == "" {
+			query = r.URL.Query().Get("q")
+		}
+		page, limit, err := pageParams(r, 20, a.maxPageSize)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if notModifiedSince(w, r, board.SnapshotModified()) {
+			return
+		}
+		a.serveSearch(w, r, board, SearchRequest{Query: query, Mode: r.URL.Query().Get("mode"), Page: page, Limit: limit})
+	})
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			searchGet(w, r)
+		case http.MethodPost:
+			req, err := decodeSearchRequest(w, r, a.maxPageSize)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			a.serveSearch(w, r, board, req)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+	mux.HandleFunc("/movers", func(w http.ResponseWriter, r *http.Request) {
+		limit := clampLimit(getQueryInt(r, "limit", 10), 10, maxMovers)
+		direction := strings.ToLower(r.URL.Query().Get("direction"))
+		if direction == "" {
+			direction = "up"
+		}
+		if direction != "up" && direction != "down" {
+			writeError(w, r, http.StatusBadRequest, "direction must be up or down")
+			return
+		}
+		writeResponse(w, r, http.StatusOK, MoversResponse{
+			Direction: direction,
+			Window:    moverWindow,
+			Movers:    board.TopMovers(limit, direction == "up"),
+		})
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, http.StatusOK, board.Stats())
+	})
+	mux.HandleFunc("GET /stats/tiers", func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, http.StatusOK, TiersResponse{Tiers: board.TierCounts()})
+	})
+	mux.HandleFunc("/stats/histogram", func(w http.ResponseWriter, r *http.Request) {
+		buckets := clampLimit(getQueryInt(r, "buckets", 50), 50, maxHistogramBins)
+		writeResponse(w, r, http.StatusOK, HistogramResponse{
+			Buckets:    buckets,
+			TotalUsers: board.UserCount(),
+			Bins:       board.Histogram(buckets),
+		})
+	})
+	mux.HandleFunc("/leaderboard/top", func(w http.ResponseWriter, r *http.Request) {
+		n := clampLimit(getQueryInt(r, "n", 10), 10, a.maxTopN)
+		writeResponse(w, r, http.StatusOK, TopResponse{
+			UpdatedAt: board.LastUpdate().UTC().Format(time.RFC3339),
+			N:         n,
+			Entries:   board.Top(n),
+		})
+	})
+	mux.HandleFunc("GET /leaderboard/rank-range", func(w http.ResponseWriter, r *http.Request) {
+		from, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+		to, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+		if errFrom != nil || errTo != nil || from < 1 || to < 1 {
+			writeError(w, r, http.StatusBadRequest, "from and to must be positive integers")
+			return
+		}
+		if from > to {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("from %d must not be above to %d", from, to))
+			return
+		}
+		entries, from, to := board.RankRange(from, to)
+		writeResponse(w, r, http.StatusOK, RankRangeResponse{
+			UpdatedAt:  board.LastUpdate().UTC().Format(time.RFC3339),
+			From:       from,
+			To:         to,
+			TotalUsers: board.UserCount(),
+			Entries:    entries,
+		})
+	})
+	mux.HandleFunc("POST /users/ranks", func(w http.ResponseWriter, r *http.Request) {
+		var body UserRanksRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			writeError(w, r, http.StatusBadRequest, `body must be {"usernames": ["a", "b"]}`)
+			return
+		}
+		if len(body.Usernames) == 0 || len(body.Usernames) > maxRankBatch {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("usernames must contain 1-%d values", maxRankBatch))
+			return
+		}
+		writeResponse(w, r, http.StatusOK, UserRanksResponse{Results: board.RanksFor(body.Usernames)})
+	})
+	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+		page, limit, err := pageParams(r, 20, a.maxPageSize)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		page = clampPage(page, calcTotalPages(board.UserCount(), limit))
+		entries, total := board.ListByUsername(page, limit)
+		totalPages := calcTotalPages(total, limit)
+		writeResponse(w, r, http.StatusOK, LeaderboardResponse{
+			UpdatedAt:  board.LastUpdate().UTC().Format(time.RFC3339),
+			TotalUsers: total,
+			Page:       page,
+			PageSize:   limit,
+			TotalPages: totalPages,
+			PageNav:    pageNav(page, totalPages),
+			Entries:    entries,
+		})
+	})
+	mux.HandleFunc("GET /users/by-rating", func(w http.ResponseWriter, r *http.Request) {
+		rating, err := strconv.Atoi(r.URL.Query().Get("rating"))
+		low, high := board.RatingBounds()
+		if err != nil || rating < low || rating > high {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("rating must be an integer in %d-%d", low, high))
+			return
+		}
+		page, limit, err := pageParams(r, 20, a.maxPageSize)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		entries, total, page := board.UsersAtRating(rating, page, limit)
+		totalPages := calcTotalPages(total, limit)
+		writeResponse(w, r, http.StatusOK, UsersAtRatingResponse{
+			Rating:     rating,
+			Total:      total,
+			Page:       page,
+			PageSize:   limit,
+			TotalPages: totalPages,
+			PageNav:    pageNav(page, totalPages),
+			Entries:    entries,
+		})
+	})
+	mux.HandleFunc("GET /compare", func(w http.ResponseWriter, r *http.Request) {
+		left, right := r.URL.Query().Get("a"), r.URL.Query().Get("b")
+		if left == "" || right == "" {
+			writeError(w, r, http.StatusBadRequest, "a and b usernames are required")
+			return
+		}
+		result, err := board.Compare(left, right)
+		var notFound *UsersNotFoundError
+		if errors.As(err, &notFound) {
+			writeError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeResponse(w, r, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /users/{username}/percentile", func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		result, ok := board.Percentile(username)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+			return
+		}
+		writeResponse(w, r, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /users/{username}/tier", func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		userTier, ok := board.UserTier(username)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+			return
+		}
+		writeResponse(w, r, http.StatusOK, userTier)
+	})
+	mux.HandleFunc("/tiers", func(w http.ResponseWriter, r *http.Request) {
+		response := TiersResponse{Tiers: board.TierCounts()}
+		if username := r.URL.Query().Get("username"); username != "" {
+			userTier, ok := board.UserTier(username)
+			if !ok {
+				writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+				return
+			}
+			response.User = &userTier
+		}
+		writeResponse(w, r, http.StatusOK, response)
+	})
+	mux.HandleFunc("/user/{username}", func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		entry, percentile, ok := board.LookupUser(username)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+			return
+		}
+		peak, _ := board.PeakRating(username)
+		writeResponse(w, r, http.StatusOK, UserResponse{
+			LeaderboardEntry: entry,
+			Percentile:       percentile,
+			PeakRating:       peak.PeakRating,
+		})
+	})
+	mux.HandleFunc("GET /users/{username}/peak", func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		peak, ok := board.PeakRating(username)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+			return
+		}
+		writeResponse(w, r, http.StatusOK, peak)
+	})
+}
@@ -0,0 +1,156 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBoard serves a fixed board, highest rating first, through the
+// Leaderboard interface. Methods the tests do not reach panic on the nil
+// embedded interface.
+type fakeBoard struct {
+	Leaderboard
+	entries []LeaderboardEntry
+	version uint64
+}
+
+func (f *fakeBoard) View() BoardView                    { return fakeView{f.entries, f.version} }
+func (f *fakeBoard) LastUpdate() time.Time              { return time.Unix(1_700_000_000, 0) }
+func (f *fakeBoard) SnapshotModified() time.Time        { return f.LastUpdate() }
+func (f *fakeBoard) FillPercentiles([]LeaderboardEntry) {}
+
+func (f *fakeBoard) AppendSearchPage(dst []LeaderboardEntry, prefix string, page int, limit int) ([]LeaderboardEntry, int, int, int) {
+	var matches []LeaderboardEntry
+	for _, entry := range f.entries {
+		if strings.HasPrefix(entry.Username, prefix) {
+			matches = append(matches, entry)
+		}
+	}
+	totalPages := calcTotalPages(len(matches), limit)
+	page = clampPage(page, totalPages)
+	start := min((page-1)*limit, len(matches))
+	return append(dst, matches[start:min(start+limit, len(matches))]...), len(matches), page, totalPages
+}
+
+type fakeView struct {
+	entries []LeaderboardEntry
+	version uint64
+}
+
+func (v fakeView) Version() uint64 { return v.version }
+func (v fakeView) Len() int        { return len(v.entries) }
+func (v fakeView) Ascending() bool { return false }
+
+func (v fakeView) ordered(ascending bool) []LeaderboardEntry {
+	entries := slices.Clone(v.entries)
+	if ascending {
+		slices.Reverse(entries)
+	}
+	return entries
+}
+
+func (v fakeView) PageOf(username string, limit int, ascending bool) (int, bool) {
+	pos := slices.IndexFunc(v.ordered(ascending), func(entry LeaderboardEntry) bool { return entry.Username == username })
+	return pos/limit + 1, pos >= 0
+}
+
+func (v fakeView) AppendPage(dst []LeaderboardEntry, page int, limit int, ascending bool) []LeaderboardEntry {
+	entries := v.ordered(ascending)
+	start := min((page-1)*limit, len(entries))
+	return append(dst, entries[start:min(start+limit, len(entries))]...)
+}
+
+func (v fakeView) SetDenseRanks([]LeaderboardEntry, int, int, bool) {}
+func (v fakeView) NextCursor(int, int) string                       { return "" }
+
+func newFakeBoardMux(board Leaderboard) *http.ServeMux {
+	mux := http.NewServeMux()
+	a := &app{maxPageSize: 100, maxTopN: 100}
+	a.registerBoardRoutes(mux, board)
+	return mux
+}
+
+func TestBoardRoutesServeFromFake(t *testing.T) {
+	board := &fakeBoard{
+		entries: []LeaderboardEntry{
+			{Rank: 1, Username: "alice", Rating: 3000},
+			{Rank: 2, Username: "albert", Rating: 2900},
+			{Rank: 3, Username: "bob", Rating: 2800},
+			{Rank: 4, Username: "carol", Rating: 2700},
+			{Rank: 5, Username: "alex", Rating: 2600},
+		},
+		version: 7,
+	}
+	mux := newFakeBoardMux(board)
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	usernames := func(entries []LeaderboardEntry) []string {
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Username
+		}
+		return names
+	}
+
+	t.Run("leaderboard", func(t *testing.T) {
+		tests := []struct {
+			target string
+			page   int
+			want   []string
+		}{
+			{"/leaderboard?page=2&limit=2", 2, []string{"bob", "carol"}},
+			{"/leaderboard?order=asc&limit=2", 1, []string{"alex", "carol"}},
+			{"/leaderboard?around_username=alex&limit=2", 3, []string{"alex"}},
+			{"/leaderboard?page=9&limit=2", 3, []string{"alex"}},
+		}
+		for _, tt := range tests {
+			rec := get(tt.target, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: got %d: %s", tt.target, rec.Code, rec.Body)
+			}
+			var body LeaderboardResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.TotalUsers != 5 || body.Page != tt.page || !slices.Equal(usernames(body.Entries), tt.want) {
+				t.Fatalf("%s: total %d, page %d, entries %v; want 5, %d, %v", tt.target, body.TotalUsers, body.Page, usernames(body.Entries), tt.page, tt.want)
+			}
+		}
+	})
+
+	t.Run("etag follows the view version", func(t *testing.T) {
+		etag := get("/leaderboard", nil).Header().Get("ETag")
+		if !strings.Contains(etag, "lb-7-") {
+			t.Fatalf("ETag %q does not carry view version 7", etag)
+		}
+		if rec := get("/leaderboard", http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified {
+			t.Fatalf("matching If-None-Match: got %d, want 304", rec.Code)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		rec := get("/search?q=al&limit=2&page=2", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", rec.Code, rec.Body)
+		}
+		var body SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Total != 3 || body.TotalPages != 2 || !slices.Equal(usernames(body.Results), []string{"alex"}) {
+			t.Fatalf("total %d, pages %d, results %v; want 3, 2, [alex]", body.Total, body.TotalPages, usernames(body.Results))
+		}
+	})
+}
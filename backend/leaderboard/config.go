@@ -0,0 +1,262 @@
+package leaderboard
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Config holds everything buildAppWithConfig needs, so the server can be
+// embedded or built with a small deterministic store without touching the
+// environment. Tracing keeps reading the standard OTEL_* variables.
+type Config struct {
+	Port string
+
+	// Seeds, when non-nil, is used as-is instead of SeedFile or the
+	// generator. SeedSpecials adds the demo rahul_* users to generated
+	// boards; it is off unless asked for.
+	Seeds        []SeedUser
+	SeedFile     string
+	SeedUsers    int
+	SeedSpecials bool
+	// NameWords and NounWords replace the generator's word lists; generated
+	// usernames join one word from each with a numeric suffix. Empty keeps
+	// the defaults.
+	NameWords []string
+	NounWords []string
+	// StateFile, when set, is loaded in place of SeedFile or the generator
+	// if it exists, and rewritten on graceful shutdown.
+	StateFile string
+	// Seed fixes the random source for generated users and rating updates,
+	// so runs with the same Seed start from the same board and apply the
+	// same updates. 0 seeds from the clock.
+	Seed int64
+
+	UpdatesPerTick int
+	// UpdateDeltaMax bounds each random rating change to +/- this much.
+	UpdateDeltaMax  int
+	TickMs          int
+	SnapshotMs      int
+	SnapshotHistory int
+
+	MinRating   int
+	MaxRating   int
+	MaxPageSize int
+	MaxTopN     int
+	// StrictRatings rejects seed, POST /users and rating-update ratings
+	// outside MinRating-MaxRating instead of clamping them.
+	StrictRatings bool
+	// DrainDelayMs keeps serving for this long after graceful shutdown starts
+	// and /readyz turns 503, so load balancers stop routing here before the
+	// listener closes.
+	DrainDelayMs int
+	// RequestTimeoutMs cuts off a request with a 503 once it has run this
+	// long; 0 disables the timeout. Streaming routes are exempt.
+	RequestTimeoutMs int
+
+	RankDirection RankDirection
+	RankingMode   RankingMode
+	// TieBreak orders users with equal ratings: username (the default),
+	// username_desc, or id for join order.
+	TieBreak string
+	// Tiers uses the TIERS syntax, "Name:minRating" pairs separated by
+	// commas. Empty keeps the default tiers.
+	Tiers string
+
+	AdminToken            string
+	Maintenance           bool
+	MaintenanceRetryAfter int
+
+	ConsistencyCheck     bool
+	ConsistencyTolerance int
+
+	// CORSOrigins lists the origins allowed to read responses, such as
+	// "https://app.example.com". Empty allows any origin.
+	CORSOrigins []string
+
+	// RateLimit is the sustained requests per second allowed per client IP,
+	// with bursts up to RateBurst; 0, the default, disables limiting.
+	// TrustForwardedFor takes the client IP from X-Forwarded-For, and must be
+	// set behind a proxy, where every request arrives from the proxy's IP.
+	RateLimit         float64
+	RateBurst         int
+	TrustForwardedFor bool
+
+	// LogLevel is debug, info, warn or error; LogFormat is json or text.
+	LogLevel  string
+	LogFormat string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Port:                  "8080",
+		SeedUsers:             10000,
+		UpdatesPerTick:        200,
+		UpdateDeltaMax:        50,
+		TickMs:                200,
+		SnapshotMs:            1000,
+		SnapshotHistory:       16,
+		MinRating:             defaultMinRating,
+		MaxRating:             defaultMaxRating,
+		MaxPageSize:           200,
+		MaxTopN:               1000,
+		RequestTimeoutMs:      5000,
+		RankDirection:         RankDescending,
+		RankingMode:           RankingCompetition,
+		MaintenanceRetryAfter: 60,
+		RateBurst:             100,
+		LogLevel:              "info",
+		LogFormat:             "json",
+	}
+}
+
+// LoadConfigFromEnv starts from DefaultConfig and applies the environment
+// variables documented in the README. Unparseable numbers and booleans keep
+// their defaults.
+func LoadConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	cfg.Port = getEnvString("PORT", cfg.Port)
+	cfg.SeedFile = getEnvString("SEED_FILE", cfg.SeedFile)
+	cfg.StateFile = getEnvString("STATE_FILE", cfg.StateFile)
+	cfg.Seed = int64(getEnvInt("SEED", int(cfg.Seed)))
+	cfg.SeedUsers = getEnvInt("SEED_USERS", cfg.SeedUsers)
+	cfg.SeedSpecials = getEnvBool("SEED_SPECIALS", cfg.SeedSpecials)
+	cfg.NameWords = splitList(getEnvString("NAME_WORDS", ""))
+	cfg.NounWords = splitList(getEnvString("NOUN_WORDS", ""))
+	cfg.UpdatesPerTick = getEnvInt("UPDATES_PER_TICK", cfg.UpdatesPerTick)
+	cfg.UpdateDeltaMax = getEnvInt("UPDATE_DELTA_MAX", cfg.UpdateDeltaMax)
+	cfg.TickMs = getEnvInt("TICK_MS", cfg.TickMs)
+	cfg.SnapshotMs = getEnvInt("SNAPSHOT_MS", cfg.SnapshotMs)
+	cfg.SnapshotHistory = getEnvInt("SNAPSHOT_HISTORY", cfg.SnapshotHistory)
+	cfg.MinRating = getEnvInt("MIN_RATING", cfg.MinRating)
+	cfg.MaxRating = getEnvInt("MAX_RATING", cfg.MaxRating)
+	cfg.StrictRatings = getEnvBool("STRICT_RATINGS", cfg.StrictRatings)
+	cfg.MaxPageSize = getEnvInt("MAX_PAGE_SIZE", cfg.MaxPageSize)
+	cfg.MaxTopN = getEnvInt("MAX_TOP_N", cfg.MaxTopN)
+	cfg.RequestTimeoutMs = getEnvInt("REQUEST_TIMEOUT_MS", cfg.RequestTimeoutMs)
+	cfg.DrainDelayMs = getEnvInt("DRAIN_DELAY_MS", cfg.DrainDelayMs)
+	cfg.RankDirection = RankDirection(strings.ToLower(getEnvString("RANK_DIRECTION", string(cfg.RankDirection))))
+	cfg.RankingMode = RankingMode(strings.ToLower(getEnvString("RANKING_MODE", string(cfg.RankingMode))))
+	cfg.TieBreak = strings.ToLower(getEnvString("TIE_BREAK", cfg.TieBreak))
+	cfg.Tiers = getEnvString("TIERS", cfg.Tiers)
+	cfg.AdminToken = getEnvString("ADMIN_TOKEN", cfg.AdminToken)
+	cfg.Maintenance = getEnvBool("MAINTENANCE", cfg.Maintenance)
+	cfg.MaintenanceRetryAfter = getEnvInt("MAINTENANCE_RETRY_AFTER", cfg.MaintenanceRetryAfter)
+	cfg.ConsistencyCheck = getEnvBool("CONSISTENCY_CHECK", cfg.ConsistencyCheck)
+	cfg.ConsistencyTolerance = getEnvInt("CONSISTENCY_TOLERANCE", cfg.ConsistencyTolerance)
+	cfg.CORSOrigins = splitList(getEnvString("CORS_ORIGINS", ""))
+	cfg.RateLimit = getEnvFloat("RATE_LIMIT", cfg.RateLimit)
+	cfg.RateBurst = getEnvInt("RATE_BURST", cfg.RateBurst)
+	cfg.TrustForwardedFor = getEnvBool("TRUST_FORWARDED_FOR", cfg.TrustForwardedFor)
+	cfg.LogLevel = strings.ToLower(getEnvString("LOG_LEVEL", cfg.LogLevel))
+	cfg.LogFormat = strings.ToLower(getEnvString("LOG_FORMAT", cfg.LogFormat))
+	return cfg
+}
+
+// splitList splits a comma-separated setting, dropping empty items.
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validateGeneratorWords checks that any name and noun joined with a
+// numbered suffix makes a valid username.
+func validateGeneratorWords(names, nouns []string) error {
+	longest := func(words []string, fallback []string) (int, error) {
+		if len(words) == 0 {
+			words = fallback
+		}
+		most := 0
+		for _, word := range words {
+			if word == "" || strings.ContainsFunc(word, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' && r != '-'
+			}) {
+				return 0, fmt.Errorf("generator word %q must be non-empty and may only contain letters, digits, '_', '.' and '-'", word)
+			}
+			most = max(most, utf8.RuneCountInString(word))
+		}
+		return most, nil
+	}
+	name, err := longest(names, defaultNameWords)
+	if err != nil {
+		return err
+	}
+	noun, err := longest(nouns, defaultNounWords)
+	if err != nil {
+		return err
+	}
+	if name+noun > generatedWordRoom {
+		return fmt.Errorf("the longest name and noun words together must be at most %d characters, got %d", generatedWordRoom, name+noun)
+	}
+	return nil
+}
+
+// Validate reports the first setting StartServerWithConfig cannot run with.
+func (c Config) Validate() error {
+	switch {
+	case c.Port == "":
+		return fmt.Errorf("port is required")
+	case c.SeedUsers < 0:
+		return fmt.Errorf("seed users must not be negative, got %d", c.SeedUsers)
+	case c.UpdatesPerTick < 0:
+		return fmt.Errorf("updates per tick must not be negative, got %d", c.UpdatesPerTick)
+	case c.UpdateDeltaMax <= 0:
+		return fmt.Errorf("update delta max must be positive, got %d", c.UpdateDeltaMax)
+	case c.TickMs <= 0:
+		return fmt.Errorf("tick interval must be positive, got %dms", c.TickMs)
+	case c.SnapshotMs <= 0:
+		return fmt.Errorf("snapshot interval must be positive, got %dms", c.SnapshotMs)
+	case c.SnapshotHistory < 0:
+		return fmt.Errorf("snapshot history must not be negative, got %d", c.SnapshotHistory)
+	case c.MinRating >= c.MaxRating:
+		return fmt.Errorf("min rating %d must be below max rating %d", c.MinRating, c.MaxRating)
+	case c.MaxPageSize <= 0:
+		return fmt.Errorf("max page size must be positive, got %d", c.MaxPageSize)
+	case c.MaxTopN <= 0:
+		return fmt.Errorf("max top n must be positive, got %d", c.MaxTopN)
+	case c.DrainDelayMs < 0:
+		return fmt.Errorf("drain delay must not be negative, got %dms", c.DrainDelayMs)
+	case c.RequestTimeoutMs < 0:
+		return fmt.Errorf("request timeout must not be negative, got %dms", c.RequestTimeoutMs)
+	case c.MaintenanceRetryAfter < 0:
+		return fmt.Errorf("maintenance retry-after must not be negative, got %d", c.MaintenanceRetryAfter)
+	case c.RateLimit < 0:
+		return fmt.Errorf("rate limit must not be negative, got %g", c.RateLimit)
+	case c.RateLimit > 0 && c.RateBurst < 1:
+		return fmt.Errorf("rate burst must be at least 1, got %d", c.RateBurst)
+	case c.ConsistencyTolerance < 0:
+		return fmt.Errorf("consistency tolerance must not be negative, got %d", c.ConsistencyTolerance)
+	}
+	if err := validateGeneratorWords(c.NameWords, c.NounWords); err != nil {
+		return err
+	}
+	if c.RankDirection != RankDescending && c.RankDirection != RankAscending {
+		return fmt.Errorf("unknown rank direction %q", c.RankDirection)
+	}
+	switch c.RankingMode {
+	case RankingCompetition, RankingDense, RankingOrdinal:
+	default:
+		return fmt.Errorf("unknown ranking mode %q", c.RankingMode)
+	}
+	switch c.TieBreak {
+	case "", "username", "username_desc", "id":
+	default:
+		return fmt.Errorf("unknown tie break %q", c.TieBreak)
+	}
+	if _, err := newLogger(io.Discard, c.LogFormat, c.LogLevel); err != nil {
+		return err
+	}
+	if c.Tiers != "" {
+		if _, err := parseTiers(c.Tiers, c.MinRating, c.MaxRating); err != nil {
+			return fmt.Errorf("tiers: %w", err)
+		}
+	}
+	return nil
+}
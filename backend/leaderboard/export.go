@@ -0,0 +1,233 @@
+package leaderboard
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ndjsonRowsPerFlush is how many export lines are buffered between flushes.
+const ndjsonRowsPerFlush = 500
+
+// SnapshotView returns every entry of the current snapshot in rank order,
+// with the ratings frozen at build time, so ranks never decrease along the
+// slice and each rank agrees with its rating. It is a full copy: one
+// LeaderboardEntry per user (about 32 bytes plus the shared username), so
+// prefer ExportFunc when streaming large boards to a sink.
+func (s *Store) SnapshotView() []LeaderboardEntry {
+	snap := s.currentSnapshot()
+	if len(snap.ids) == 0 {
+		return []LeaderboardEntry{}
+	}
+	return s.entriesFrom(snap, 0, len(snap.ids))
+}
+
+// ExportFunc walks a single snapshot in rank order, calling fn for each entry
+// until fn returns false. It holds no locks and allocates nothing per entry.
+func (s *Store) ExportFunc(fn func(LeaderboardEntry) bool) {
+	s.exportSnapshot(s.currentSnapshot(), fn)
+}
+
+// exportSnapshot is ExportFunc over a snapshot the caller already holds.
+func (s *Store) exportSnapshot(snap *snapshot, fn func(LeaderboardEntry) bool) {
+	for pos := range snap.ids {
+		entry, _ := s.entryAt(snap, pos)
+		if !fn(entry) {
+			return
+		}
+	}
+}
+
+const (
+	snapshotBinaryMagic   = "LBSN"
+	snapshotBinaryVersion = 1
+	snapshotKindFull      = 0
+	snapshotKindDelta     = 1
+)
+
+// WriteSnapshotBinary encodes the current snapshot in the compact binary
+// format. With since set to a retained version only positions whose user,
+// rank or rating changed are written; otherwise, or when the ranking mode
+// changed in between, every position is written as a full frame. All
+// integers are big-endian:
+//
+//	magic "LBSN" | format u8 | kind u8 (0 full, 1 delta) | reserved u16
+//	base version u64 | target version u64 | positions u32 | records u32
+//	records: position u32 | rank u32 | rating i32 | name len u16 | name
+func (s *Store) WriteSnapshotBinary(w io.Writer, since uint64) (uint64, error) {
+	current := s.currentSnapshot()
+	return current.version, s.writeSnapshotBinary(w, current, since)
+}
+
+func (s *Store) writeSnapshotBinary(w io.Writer, current *snapshot, since uint64) error {
+	kind := uint8(snapshotKindFull)
+	base := uint64(0)
+	var positions []int
+
+	previous, ok := s.snapshotAt(since)
+	if since != 0 && ok && previous.mode == current.mode {
+		kind = snapshotKindDelta
+		base = previous.version
+		for pos := range current.ids {
+			if pos >= len(previous.ids) || previous.ids[pos] != current.ids[pos] ||
+				previous.ratings[pos] != current.ratings[pos] || previous.ranks[pos] != current.ranks[pos] {
+				positions = append(positions, pos)
+			}
+		}
+	}
+
+	records := len(current.ids)
+	if kind == snapshotKindDelta {
+		records = len(positions)
+	}
+
+	buf := bufio.NewWriter(w)
+	header := make([]byte, 0, 32)
+	header = append(header, snapshotBinaryMagic...)
+	header = append(header, snapshotBinaryVersion, kind, 0, 0)
+	header = binary.BigEndian.AppendUint64(header, base)
+	header = binary.BigEndian.AppendUint64(header, current.version)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(current.ids)))
+	header = binary.BigEndian.AppendUint32(header, uint32(records))
+	if _, err := buf.Write(header); err != nil {
+		return err
+	}
+
+	table := s.loadTable()
+	record := make([]byte, 0, 14)
+	writeRecord := func(pos int) error {
+		name := table.users[current.ids[pos]].Username
+		if len(name) > 0xffff {
+			name = name[:0xffff]
+		}
+		record = binary.BigEndian.AppendUint32(record[:0], uint32(pos))
+		record = binary.BigEndian.AppendUint32(record, uint32(current.ranks[pos]))
+		record = binary.BigEndian.AppendUint32(record, uint32(current.ratings[pos]))
+		record = binary.BigEndian.AppendUint16(record, uint16(len(name)))
+		if _, err := buf.Write(record); err != nil {
+			return err
+		}
+		_, err := buf.WriteString(name)
+		return err
+	}
+
+	if kind == snapshotKindDelta {
+		for _, pos := range positions {
+			if err := writeRecord(pos); err != nil {
+				return err
+			}
+		}
+	} else {
+		for pos := range current.ids {
+			if err := writeRecord(pos); err != nil {
+				return err
+			}
+		}
+	}
+
+	return buf.Flush()
+}
+
+// writeNDJSONExport streams every entry of one snapshot as a JSON line, in
+// board order or reversed when ascending differs from the rank direction.
+// The snapshot version and user count go out as headers, since the body
+// has no envelope. It stops early if the client goes away.
+func writeNDJSONExport(w http.ResponseWriter, r *http.Request, store *Store, ascending bool) {
+	snap := store.currentSnapshot()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.ndjson"`)
+	w.Header().Set("X-Snapshot-Version", strconv.FormatUint(snap.version, 10))
+	w.Header().Set("X-Total-Users", strconv.Itoa(len(snap.ids)))
+	flusher, _ := w.(http.Flusher)
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+
+	reversed := ascending != store.ascending
+	for i := range snap.ids {
+		pos := i
+		if reversed {
+			pos = len(snap.ids) - 1 - i
+		}
+		entry, _ := store.entryAt(snap, pos)
+		if enc.Encode(entry) != nil {
+			return
+		}
+		if (i+1)%ndjsonRowsPerFlush == 0 {
+			if r.Context().Err() != nil || buf.Flush() != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	_ = buf.Flush()
+}
+
+// writeSQLExport streams the snapshot as multi-row INSERT statements in
+// standard SQL (PostgreSQL, SQLite): usernames are quoted by doubling single
+// quotes and the table name is validated and double-quoted. The version in
+// the header and the rows come from the same snapshot.
+func writeSQLExport(w http.ResponseWriter, store *Store, table string) {
+	w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", table+".sql"))
+	flusher, _ := w.(http.Flusher)
+	buf := bufio.NewWriter(w)
+
+	snap := store.currentSnapshot()
+	quotedTable := quoteSQLIdentifier(table)
+	fmt.Fprintf(buf, "-- leaderboard snapshot version %d\n", snap.version)
+	rows := 0
+	store.exportSnapshot(snap, func(entry LeaderboardEntry) bool {
+		if rows%sqlRowsPerInsert == 0 {
+			if rows > 0 {
+				buf.WriteString(";\n")
+			}
+			fmt.Fprintf(buf, "INSERT INTO %s (rank, username, rating) VALUES\n", quotedTable)
+		} else {
+			buf.WriteString(",\n")
+		}
+		fmt.Fprintf(buf, "(%d, %s, %d)", entry.Rank, quoteSQLString(entry.Username), entry.Rating)
+		rows++
+		if rows%sqlRowsPerInsert == 0 && flusher != nil {
+			if buf.Flush() != nil {
+				return false
+			}
+			flusher.Flush()
+		}
+		return true
+	})
+	if rows > 0 {
+		buf.WriteString(";\n")
+	}
+	_ = buf.Flush()
+}
+
+func validSQLIdentifier(name string) bool {
+	if name == "" || len(name) > 63 {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func quoteSQLIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteSQLString(value string) string {
+	value = strings.ReplaceAll(value, "\x00", "")
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
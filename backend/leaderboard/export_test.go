@@ -0,0 +1,222 @@
+package leaderboard
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// binaryFrame is a decoded WriteSnapshotBinary frame, with each record
+// rendered as "position:rank:username:rating".
+type binaryFrame struct {
+	kind    uint8
+	base    uint64
+	target  uint64
+	total   uint32
+	records []string
+}
+
+func decodeSnapshotBinary(t *testing.T, data []byte) binaryFrame {
+	t.Helper()
+	if len(data) < 32 || string(data[:4]) != snapshotBinaryMagic || data[4] != snapshotBinaryVersion {
+		t.Fatalf("bad header % x", data[:min(len(data), 32)])
+	}
+	frame := binaryFrame{
+		kind:   data[5],
+		base:   binary.BigEndian.Uint64(data[8:]),
+		target: binary.BigEndian.Uint64(data[16:]),
+		total:  binary.BigEndian.Uint32(data[24:]),
+	}
+	count := binary.BigEndian.Uint32(data[28:])
+	rest := data[32:]
+	for i := uint32(0); i < count; i++ {
+		if len(rest) < 14 {
+			t.Fatalf("record %d truncated", i)
+		}
+		nameLen := int(binary.BigEndian.Uint16(rest[12:]))
+		frame.records = append(frame.records, fmt.Sprintf("%d:%d:%s:%d",
+			binary.BigEndian.Uint32(rest), binary.BigEndian.Uint32(rest[4:]),
+			rest[14:14+nameLen], int32(binary.BigEndian.Uint32(rest[8:]))))
+		rest = rest[14+nameLen:]
+	}
+	if len(rest) != 0 {
+		t.Fatalf("%d trailing bytes", len(rest))
+	}
+	return frame
+}
+
+func TestSnapshotBinaryDelta(t *testing.T) {
+	s, err := NewStore([]SeedUser{
+		{Username: "ana", Rating: 3000},
+		{Username: "ben", Rating: 2000},
+		{Username: "cai", Rating: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetSnapshotHistory(4)
+	s.RefreshSnapshot()
+	base := s.SnapshotVersion()
+
+	// ana drops into a tie with ben, so ben keeps the same position and rating
+	// but moves from rank 2 to rank 1.
+	if _, err := s.SetRatingByUsername("ana", 2000); err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	var out bytes.Buffer
+	target, err := s.WriteSnapshotBinary(&out, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := decodeSnapshotBinary(t, out.Bytes())
+	if frame.kind != snapshotKindDelta || frame.base != base || frame.target != target || frame.total != 3 {
+		t.Fatalf("got kind %d base %d target %d total %d, want a delta from %d to %d over 3", frame.kind, frame.base, frame.target, frame.total, base, target)
+	}
+	if got, want := fmt.Sprint(frame.records), "[0:1:ana:2000 1:1:ben:2000]"; got != want {
+		t.Fatalf("delta records %s, want %s", got, want)
+	}
+
+	// A ranking mode switch changes what every rank means, so the delta
+	// falls back to a full frame.
+	base = target
+	if err := s.SetRankingMode(RankingOrdinal); err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	out.Reset()
+	if _, err := s.WriteSnapshotBinary(&out, base); err != nil {
+		t.Fatal(err)
+	}
+	frame = decodeSnapshotBinary(t, out.Bytes())
+	if frame.kind != snapshotKindFull || frame.base != 0 {
+		t.Fatalf("got kind %d base %d after a mode switch, want a full frame", frame.kind, frame.base)
+	}
+	if got, want := fmt.Sprint(frame.records), "[0:1:ana:2000 1:2:ben:2000 2:3:cai:1000]"; got != want {
+		t.Fatalf("full records %s, want %s", got, want)
+	}
+}
+
+func TestSQLExportReadsOneSnapshot(t *testing.T) {
+	s, err := NewStore([]SeedUser{{Username: "ana", Rating: 3000}, {Username: "o'neil", Rating: 2000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	// A live change not yet published must not reach the rows, whose
+	// version header names the snapshot they came from.
+	if _, err := s.SetRatingByUsername("o'neil", 4000); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	writeSQLExport(rec, s, "board")
+	want := fmt.Sprintf("-- leaderboard snapshot version %d\n"+
+		"INSERT INTO \"board\" (rank, username, rating) VALUES\n"+
+		"(1, 'ana', 3000),\n"+
+		"(2, 'o''neil', 2000);\n", s.SnapshotVersion())
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNDJSONExportLineCount(t *testing.T) {
+	const users = 2*ndjsonRowsPerFlush + 7
+	a := newTestApp(t, testSeeds(users), nil)
+	var board LeaderboardResponse
+	if err := json.Unmarshal(serve(a, http.MethodGet, "/leaderboard", "", nil).Body.Bytes(), &board); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range []string{"", "asc"} {
+		rec := serve(a, http.MethodGet, "/export.ndjson?order="+order, "", nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("order %q: got %d %q", order, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if got := rec.Header().Get("X-Total-Users"); got != strconv.Itoa(board.TotalUsers) {
+			t.Fatalf("order %q: X-Total-Users %s, want %d", order, got, board.TotalUsers)
+		}
+		scanner := bufio.NewScanner(rec.Body)
+		lines := 0
+		var first, last LeaderboardEntry
+		for scanner.Scan() {
+			var entry LeaderboardEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Fatalf("order %q: line %d %q is not JSON: %v", order, lines+1, scanner.Text(), err)
+			}
+			if lines == 0 {
+				first = entry
+			}
+			last = entry
+			lines++
+		}
+		if lines != board.TotalUsers || lines != users {
+			t.Fatalf("order %q: %d lines, want total_users %d", order, lines, board.TotalUsers)
+		}
+		top, bottom := first, last
+		if order == "asc" {
+			top, bottom = last, first
+		}
+		if top.Rank != 1 || top.Username != "user_000" || bottom.Rating != defaultMinRating {
+			t.Fatalf("order %q: first %+v, last %+v", order, first, last)
+		}
+	}
+}
+
+func TestSnapshotViewIsMonotonic(t *testing.T) {
+	for _, ascending := range []bool{false, true} {
+		for _, mode := range []RankingMode{RankingCompetition, RankingDense, RankingOrdinal} {
+			t.Run(fmt.Sprintf("ascending=%v/%s", ascending, mode), func(t *testing.T) {
+				s, err := NewStoreWithBounds(randomSeeds(500, 100, 160, 3), 100, 160)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ascending {
+					if err := s.SetRankDirection(RankAscending); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := s.SetRankingMode(mode); err != nil {
+					t.Fatal(err)
+				}
+				s.RefreshSnapshot()
+				// Live churn after the build must not leak into the view.
+				applyRandomUpdates(s, 300, 8)
+
+				view := s.SnapshotView()
+				if len(view) != 500 {
+					t.Fatalf("view holds %d entries, want 500", len(view))
+				}
+				if view[0].Rank != 1 {
+					t.Fatalf("first entry ranked %d", view[0].Rank)
+				}
+				for i := 1; i < len(view); i++ {
+					prev, cur := view[i-1], view[i]
+					behind := cur.Rating < prev.Rating
+					if ascending {
+						behind = cur.Rating > prev.Rating
+					}
+					switch {
+					case cur.Rank < prev.Rank:
+						t.Fatalf("rank fell from %d to %d at %d", prev.Rank, cur.Rank, i)
+					case cur.Rating != prev.Rating && !behind:
+						t.Fatalf("rating %d follows %d at %d", cur.Rating, prev.Rating, i)
+					case cur.Rating == prev.Rating && mode != RankingOrdinal && cur.Rank != prev.Rank:
+						t.Fatalf("tie at %d split into ranks %d and %d", cur.Rating, prev.Rank, cur.Rank)
+					case mode == RankingCompetition && behind && cur.Rank != i+1:
+						t.Fatalf("competition rank %d at position %d", cur.Rank, i+1)
+					case mode == RankingDense && behind && cur.Rank != prev.Rank+1:
+						t.Fatalf("dense rank jumped from %d to %d", prev.Rank, cur.Rank)
+					case mode == RankingOrdinal && cur.Rank != i+1:
+						t.Fatalf("ordinal rank %d at position %d", cur.Rank, i+1)
+					}
+				}
+			})
+		}
+	}
+}
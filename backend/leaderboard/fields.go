@@ -0,0 +1,145 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// entryFields is the set of LeaderboardEntry keys a ?fields= request keeps.
+// The zero value keeps the whole entry.
+type entryFields uint8
+
+const (
+	fieldRank entryFields = 1 << iota
+	fieldUsername
+	fieldRating
+	fieldPercentile
+)
+
+var entryFieldNames = map[string]entryFields{
+	"rank":       fieldRank,
+	"username":   fieldUsername,
+	"rating":     fieldRating,
+	"percentile": fieldPercentile,
+}
+
+// parseEntryFields reads a comma-separated ?fields= list. Unknown names are
+// skipped, or rejected with ?strict=1; a list naming no known field keeps
+// the whole entry.
+func parseEntryFields(r *http.Request) (entryFields, error) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return 0, nil
+	}
+	strict := getQueryBool(r, "strict", false)
+	var fields entryFields
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		field, ok := entryFieldNames[name]
+		if !ok {
+			if strict {
+				return 0, fmt.Errorf("unknown field %q; use rank, username, rating or percentile", name)
+			}
+			continue
+		}
+		fields |= field
+	}
+	return fields, nil
+}
+
+// projectedEntries encodes entries with only the selected keys, in the
+// usual key order.
+type projectedEntries struct {
+	entries []LeaderboardEntry
+	fields  entryFields
+}
+
+func (p projectedEntries) MarshalJSON() ([]byte, error) {
+	if p.entries == nil {
+		return []byte("null"), nil
+	}
+	out := make([]byte, 0, 16+len(p.entries)*48)
+	out = append(out, '[')
+	for i, entry := range p.entries {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, '{')
+		first := true
+		key := func(name string) {
+			if !first {
+				out = append(out, ',')
+			}
+			first = false
+			out = append(out, '"')
+			out = append(out, name...)
+			out = append(out, '"', ':')
+		}
+		if p.fields&fieldRank != 0 {
+			key("rank")
+			out = strconv.AppendInt(out, int64(entry.Rank), 10)
+		}
+		if p.fields&fieldUsername != 0 {
+			key("username")
+			name, err := json.Marshal(entry.Username)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, name...)
+		}
+		if p.fields&fieldRating != 0 {
+			key("rating")
+			out = strconv.AppendInt(out, int64(entry.Rating), 10)
+		}
+		if p.fields&fieldPercentile != 0 && entry.Percentile != nil {
+			key("percentile")
+			out = strconv.AppendFloat(out, *entry.Percentile, 'g', -1, 64)
+		}
+		// Neighbors are only present when asked for, so they are kept
+		// whole whatever the field list.
+		for _, neighbor := range []struct {
+			name  string
+			entry *LeaderboardEntry
+		}{{"above", entry.Above}, {"below", entry.Below}} {
+			if neighbor.entry == nil {
+				continue
+			}
+			key(neighbor.name)
+			value, err := json.Marshal(neighbor.entry)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value...)
+		}
+		out = append(out, '}')
+	}
+	return append(out, ']'), nil
+}
+
+// The field-filtered responses shadow the embedded entry list with a
+// projected one under the same JSON key.
+type projectedLeaderboardResponse struct {
+	LeaderboardResponse
+	Entries projectedEntries `json:"entries"`
+}
+
+type projectedCursorResponse struct {
+	LeaderboardCursorResponse
+	Entries projectedEntries `json:"entries"`
+}
+
+type projectedRangeResponse struct {
+	LeaderboardRangeResponse
+	Entries projectedEntries `json:"entries"`
+}
+
+type projectedSearchResponse struct {
+	SearchResponse
+	Results projectedEntries `json:"results"`
+}
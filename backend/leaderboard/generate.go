@@ -0,0 +1,133 @@
+package leaderboard
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// newRand returns a generator seeded with seed, or with the clock when seed
+// is 0, so a fixed SEED reproduces the same sequence.
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+var (
+	defaultNameWords = []string{
+		"rahul", "aarav", "arjun", "isha", "kavya", "neha", "vivek", "meera", "saanvi", "anaya",
+		"alex", "maria", "liam", "olivia", "noah", "emma", "ethan", "ava", "mia", "logan",
+	}
+	defaultNounWords = []string{"nova", "atlas", "pixel", "ember", "quill", "ridge", "spark", "zen", "orbit", "flux"}
+)
+
+const (
+	// randomNameSuffixes is how many four-digit suffixes random names use.
+	randomNameSuffixes = 9999
+
+	// maxNameCollisions is how many random usernames in a row may collide
+	// before generateUsers switches to numbered names, which keeps a count
+	// beyond the random name space from looping forever.
+	maxNameCollisions = 100
+
+	// generatedWordRoom is how much of a username the two words may take,
+	// leaving room for the separators and a numbered suffix.
+	generatedWordRoom = maxUsernameLength - 10
+)
+
+// generateUsers returns exactly count users with random ratings in
+// [low, high], drawn from newRand(seed). Usernames join a word from names
+// and one from nouns, nil selecting the default lists, with a random
+// four-digit suffix. Once a quarter of that name space is used, retries
+// would become common, so the rest get a counter suffix above the random
+// range instead, which never repeats. When includeSpecials is set the demo
+// "rahul" users are part of that count rather than added on top of it;
+// their fixed ratings are clamped by the store.
+func generateUsers(count int, includeSpecials bool, low, high int, seed int64, names, nouns []string) []SeedUser {
+	if len(names) == 0 {
+		names = defaultNameWords
+	}
+	if len(nouns) == 0 {
+		nouns = defaultNounWords
+	}
+	randomLimit := len(names) * len(nouns) * randomNameSuffixes / 4
+
+	source := newRand(seed)
+	// seen is keyed on the normalized username, as the store is, so words
+	// that differ only in case cannot produce two users the store rejects.
+	seen := make(map[string]bool, count)
+	users := make([]SeedUser, 0, count)
+
+	addUser := func(username string) {
+		if seen[normalizeUsername(username)] {
+			return
+		}
+		seen[normalizeUsername(username)] = true
+		rating := source.Intn(high-low+1) + low
+		users = append(users, SeedUser{
+			Username: username,
+			Rating:   rating,
+		})
+	}
+
+	addUserWithRating := func(username string, rating int) {
+		if seen[normalizeUsername(username)] {
+			return
+		}
+		seen[normalizeUsername(username)] = true
+		users = append(users, SeedUser{
+			Username: username,
+			Rating:   rating,
+		})
+	}
+
+	specials := []struct {
+		name   string
+		rating int
+	}{
+		{name: "rahul", rating: 4600},
+		{name: "rahul_burman", rating: 3900},
+		{name: "rahul_mathur", rating: 3900},
+		{name: "rahul_kumar", rating: 1234},
+	}
+	if includeSpecials {
+		for _, item := range specials {
+			addUserWithRating(item.name, item.rating)
+		}
+		addUser("rahul_jain")
+		addUser("rahul_sen")
+
+		for i := 1; i <= 200; i++ {
+			addUser(fmt.Sprintf("rahul_%03d", i))
+		}
+	}
+	if len(users) > count {
+		users = users[:count]
+	}
+
+	collisions := 0
+	randomNames := 0
+	counter := randomNameSuffixes
+	for len(users) < count {
+		name := names[source.Intn(len(names))]
+		noun := nouns[source.Intn(len(nouns))]
+		if randomNames >= randomLimit || collisions >= maxNameCollisions {
+			counter++
+			addUser(fmt.Sprintf("%s_%s_%d", name, noun, counter))
+			continue
+		}
+		suffix := source.Intn(randomNameSuffixes)
+		username := fmt.Sprintf("%s_%s_%04d", name, noun, suffix)
+		if seen[normalizeUsername(username)] {
+			collisions++
+			continue
+		}
+		collisions = 0
+		randomNames++
+		addUser(username)
+	}
+
+	return users
+}
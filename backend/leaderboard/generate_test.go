@@ -0,0 +1,125 @@
+package leaderboard
+
+import (
+	"slices"
+	"testing"
+)
+
+// largeGeneratedBoard is past the quarter of the default random name space,
+// so generateUsers switches to numbered names partway through.
+const largeGeneratedBoard = 500_000
+
+func TestGenerateUsersWithCaseDuplicateWords(t *testing.T) {
+	names := []string{"Ann", "ann", "ANN"}
+	nouns := []string{"Fox", "fox"}
+	for _, count := range []int{50, 3000} {
+		users := generateUsers(count, true, 100, 300, 1, names, nouns)
+		if len(users) != count {
+			t.Fatalf("generated %d users, want %d", len(users), count)
+		}
+		if _, err := NewStoreWithBounds(users, 100, 300); err != nil {
+			t.Fatalf("store rejected %d generated users: %v", count, err)
+		}
+	}
+}
+
+func TestGenerateUsersNormalizedNamesAreUnique(t *testing.T) {
+	users := generateUsers(largeGeneratedBoard, true, 100, 5000, 1, nil, nil)
+	if len(users) != largeGeneratedBoard {
+		t.Fatalf("generated %d users, want %d", len(users), largeGeneratedBoard)
+	}
+	seen := make(map[string]string, len(users))
+	for _, user := range users {
+		key := normalizeUsername(user.Username)
+		if first, ok := seen[key]; ok {
+			t.Fatalf("%q and %q normalize to the same username %q", first, user.Username, key)
+		}
+		seen[key] = user.Username
+	}
+}
+
+func BenchmarkGenerateUsers(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		generateUsers(largeGeneratedBoard, true, 100, 5000, int64(i+1), nil, nil)
+	}
+}
+
+func TestSeedSpecialsAreOptIn(t *testing.T) {
+	// Random names can start with "rahul" too, but only the demo users are
+	// named exactly these.
+	demoNames := []string{"rahul", "rahul_burman", "rahul_mathur", "rahul_kumar", "rahul_jain"}
+	for _, specials := range []bool{false, true} {
+		a := newTestApp(t, nil, func(cfg *Config) {
+			cfg.SeedUsers = 5
+			cfg.SeedSpecials = specials
+		})
+		for _, name := range demoNames {
+			if _, _, found := a.store.LookupUser(name); found != specials {
+				t.Errorf("SeedSpecials %v: demo user %q found %v", specials, name, found)
+			}
+		}
+		if a.store.UserCount() != 5 {
+			t.Fatalf("SeedSpecials %v: %d users, want 5", specials, a.store.UserCount())
+		}
+	}
+	if DefaultConfig().SeedSpecials {
+		t.Fatal("demo users are seeded by default")
+	}
+}
+
+func TestSameSeedBuildsSameSnapshot(t *testing.T) {
+	build := func(seed int64) *Store {
+		s, err := NewStore(generateUsers(2000, false, defaultMinRating, defaultMaxRating, seed, nil, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := newRand(seed)
+		for tick := 0; tick < 50; tick++ {
+			s.randomTick(source, 100, 50)
+		}
+		s.RefreshSnapshot()
+		return s
+	}
+	first, second := build(7), build(7)
+	compareSnapshots(t, second.currentSnapshot(), first.currentSnapshot())
+	for i, user := range first.loadTable().users {
+		if other := second.loadTable().users[i].Username; user.Username != other {
+			t.Fatalf("user %d is %q and %q under the same seed", i, user.Username, other)
+		}
+	}
+
+	other := build(8)
+	if slices.Equal(other.currentSnapshot().ratings, first.currentSnapshot().ratings) {
+		t.Fatal("seeds 7 and 8 built the same board")
+	}
+}
+
+func TestSeedUsersGivesExactUserCount(t *testing.T) {
+	for _, count := range []int{1, 3, 10, 250} {
+		for _, specials := range []bool{false, true} {
+			a := newTestApp(t, nil, func(cfg *Config) {
+				cfg.SeedUsers = count
+				cfg.SeedSpecials = specials
+			})
+			s := a.store
+			if got := s.UserCount(); got != count {
+				t.Fatalf("SEED_USERS=%d specials %v: %d users", count, specials, got)
+			}
+			for _, username := range []string{"count_a", "count_b"} {
+				if _, err := s.AddUser(username, 1500); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := s.AddUser("COUNT_A", 1500); err == nil {
+				t.Fatal("a case-insensitive duplicate was added")
+			}
+			if !s.RemoveUser("count_a") || s.RemoveUser("count_a") || s.RemoveUser("nobody_here") {
+				t.Fatal("removing count_a once, then again, then an unknown user did not report true, false, false")
+			}
+			if got := s.UserCount(); got != count+1 {
+				t.Fatalf("SEED_USERS=%d specials %v: %d users after two adds and a remove, want %d", count, specials, got, count+1)
+			}
+		}
+	}
+}
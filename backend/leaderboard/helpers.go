@@ -0,0 +1,257 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func calcTotalPages(total int, limit int) int {
+	if total <= 0 || limit <= 0 {
+		return 0
+	}
+	return (total + limit - 1) / limit
+}
+
+func clampPage(page int, totalPages int) int {
+	if page < 1 {
+		page = 1
+	}
+	if totalPages > 0 && page > totalPages {
+		page = totalPages
+	}
+	return page
+}
+
+func pageNav(page int, totalPages int) PageNav {
+	if totalPages <= 0 {
+		return PageNav{}
+	}
+	return PageNav{
+		HasPrev:   page > 1,
+		HasNext:   page < totalPages,
+		FirstPage: 1,
+		LastPage:  totalPages,
+	}
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvString(key, fallback string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func getQueryInt(r *http.Request, key string, fallback int) int {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func getQueryBool(r *http.Request, key string, fallback bool) bool {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+// pageParams reads the page and limit query parameters. By default bad
+// values fall back to page 1 and defaultLimit and limit is capped at
+// maxLimit; with ?strict=1 they are rejected with an error naming the
+// offending parameter instead.
+func pageParams(r *http.Request, defaultLimit int, maxLimit int) (int, int, error) {
+	strict := getQueryBool(r, "strict", false)
+	page, err := parseQueryInt(r, "page", 1)
+	if err == nil && page < 1 {
+		err = fmt.Errorf("page must be at least 1, got %d", page)
+	}
+	if err != nil {
+		if strict {
+			return 0, 0, err
+		}
+		page = 1
+	}
+
+	limit, err := parseQueryInt(r, "limit", defaultLimit)
+	if err == nil && limit <= 0 {
+		err = fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	if err != nil {
+		if strict {
+			return 0, 0, err
+		}
+		limit = defaultLimit
+	}
+	if limit > maxLimit && strict {
+		return 0, 0, fmt.Errorf("limit must be at most %d, got %d", maxLimit, limit)
+	}
+	return page, clampLimit(limit, defaultLimit, maxLimit), nil
+}
+
+// clampLimit bounds a requested count: non-positive values become fallback
+// and values above max become max.
+func clampLimit(limit int, fallback int, max int) int {
+	if limit <= 0 {
+		return fallback
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+func parseQueryInt(r *http.Request, key string, fallback int) (int, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil {
+		return fallback, fmt.Errorf("%s must be an integer, got %q", key, raw)
+	}
+	return parsed, nil
+}
+
+// etagMatches reports whether an If-None-Match header matches etag using
+// the weak comparison RFC 9110 prescribes for conditional GETs.
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// lastModified is the Last-Modified time for data last changed at last.
+// HTTP dates drop sub-second precision, so it rounds up to the next whole
+// second once that second is over, which keeps any later change after it.
+// Within that second it rounds down instead; the client then simply gets no
+// 304 with that date.
+func lastModified(last time.Time, now time.Time) time.Time {
+	floor := last.Truncate(time.Second)
+	if floor.Equal(last) {
+		return floor
+	}
+	if ceil := floor.Add(time.Second); !now.Before(ceil) {
+		return ceil
+	}
+	return floor
+}
+
+// notModifiedSince sets Last-Modified from last and, when the request's
+// If-Modified-Since is at or after last, answers 304 and returns true. As
+// RFC 9110 requires, If-Modified-Since is ignored when If-None-Match is
+// present, leaving the ETag check to decide.
+func notModifiedSince(w http.ResponseWriter, r *http.Request, last time.Time) bool {
+	if last.IsZero() {
+		return false
+	}
+	w.Header().Set("Last-Modified", lastModified(last, time.Now()).UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || last.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// writeResponse encodes payload as JSON, compactly or indented when the
+// request asks for ?pretty=1, or as MessagePack when the Accept header asks
+// for application/msgpack. MessagePack is transcoded from the JSON encoding,
+// so both formats follow the same json tags and marshalers. The body is
+// built in a pooled buffer and sent with a single Write; encoding before the
+// header goes out means a payload that fails to encode becomes a 500
+// instead of a truncated body.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, payload any) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	msgpack := acceptsMsgpack(r)
+	enc := json.NewEncoder(buf)
+	if !msgpack && getQueryBool(r, "pretty", false) {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(payload); err != nil {
+		buf.Reset()
+		status = http.StatusInternalServerError
+		_ = enc.Encode(map[string]string{"error": "failed to encode response"})
+	}
+
+	body, contentType := buf.Bytes(), "application/json"
+	if msgpack {
+		packed, err := appendMsgpackFromJSON(nil, body)
+		if err != nil {
+			packed, _ = appendMsgpackFromJSON(nil, []byte(`{"error":"failed to encode response"}`))
+			status = http.StatusInternalServerError
+		}
+		body, contentType = packed, msgpackContentType
+	}
+
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeResponse(w, r, status, map[string]string{"error": message})
+}
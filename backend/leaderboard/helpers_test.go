@@ -0,0 +1,263 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		total, limit, page int
+		wantPage           int
+		wantNav            PageNav
+	}{
+		{0, 20, 1, 1, PageNav{}},
+		{0, 20, 5, 5, PageNav{}},
+		{1, 20, 1, 1, PageNav{FirstPage: 1, LastPage: 1}},
+		{20, 20, 1, 1, PageNav{FirstPage: 1, LastPage: 1}},
+		{21, 20, 1, 1, PageNav{HasNext: true, FirstPage: 1, LastPage: 2}},
+		{21, 20, 2, 2, PageNav{HasPrev: true, FirstPage: 1, LastPage: 2}},
+		{21, 20, 9, 2, PageNav{HasPrev: true, FirstPage: 1, LastPage: 2}},
+		{100, 10, 5, 5, PageNav{HasPrev: true, HasNext: true, FirstPage: 1, LastPage: 10}},
+		{100, 10, 0, 1, PageNav{HasNext: true, FirstPage: 1, LastPage: 10}},
+		{100, 10, -3, 1, PageNav{HasNext: true, FirstPage: 1, LastPage: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d users, limit %d, page %d", tt.total, tt.limit, tt.page), func(t *testing.T) {
+			totalPages := calcTotalPages(tt.total, tt.limit)
+			page := clampPage(tt.page, totalPages)
+			if page != tt.wantPage {
+				t.Fatalf("clamped page %d, want %d", page, tt.wantPage)
+			}
+			if nav := pageNav(page, totalPages); nav != tt.wantNav {
+				t.Fatalf("nav %+v, want %+v", nav, tt.wantNav)
+			}
+		})
+	}
+}
+
+func TestPaginatedResponses(t *testing.T) {
+	a := newTestApp(t, testSeeds(45), nil)
+	tests := []struct {
+		target   string
+		wantPage int
+		wantNav  PageNav
+	}{
+		{"/leaderboard?limit=20", 1, PageNav{HasNext: true, FirstPage: 1, LastPage: 3}},
+		{"/leaderboard?limit=20&page=2", 2, PageNav{HasPrev: true, HasNext: true, FirstPage: 1, LastPage: 3}},
+		{"/leaderboard?limit=20&page=3", 3, PageNav{HasPrev: true, FirstPage: 1, LastPage: 3}},
+		{"/leaderboard?limit=20&page=50", 3, PageNav{HasPrev: true, FirstPage: 1, LastPage: 3}},
+		{"/search?q=user_00&limit=4", 1, PageNav{HasNext: true, FirstPage: 1, LastPage: 3}},
+		{"/search?q=user_00&limit=4&page=3", 3, PageNav{HasPrev: true, FirstPage: 1, LastPage: 3}},
+		{"/search?q=nobody", 1, PageNav{}},
+		{"/users?limit=20&page=3", 3, PageNav{HasPrev: true, FirstPage: 1, LastPage: 3}},
+		{"/users/by-rating?rating=4000", 1, PageNav{FirstPage: 1, LastPage: 1}},
+		{"/users/by-rating?rating=3990&page=9", 1, PageNav{FirstPage: 1, LastPage: 1}},
+		{"/users/by-rating?rating=4005", 1, PageNav{}},
+	}
+	for _, tt := range tests {
+		rec := serve(a, http.MethodGet, tt.target, "", nil)
+		var body struct {
+			Page int `json:"page"`
+			PageNav
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Page != tt.wantPage || body.PageNav != tt.wantNav {
+			t.Errorf("%s: page %d, nav %+v; want %d, %+v", tt.target, body.Page, body.PageNav, tt.wantPage, tt.wantNav)
+		}
+	}
+}
+
+func TestPageParamsLenient(t *testing.T) {
+	tests := []struct {
+		query string
+		page  int
+		limit int
+	}{
+		{"", 1, 20},
+		{"page=3&limit=50", 3, 50},
+		{"page=0&limit=0", 1, 20},
+		{"page=-2&limit=-5", 1, 20},
+		{"page=abc&limit=xyz", 1, 20},
+		{"limit=500", 1, 200},
+		{"limit=200", 1, 200},
+	}
+	for _, tt := range tests {
+		page, limit, err := pageParams(httptest.NewRequest(http.MethodGet, "/leaderboard?"+tt.query, nil), 20, 200)
+		if err != nil || page != tt.page || limit != tt.limit {
+			t.Errorf("%q: page %d, limit %d, error %v; want %d, %d", tt.query, page, limit, err, tt.page, tt.limit)
+		}
+	}
+}
+
+func TestWriteResponsePretty(t *testing.T) {
+	payload := map[string]any{"rank": 1, "username": "alice"}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "{\"rank\":1,\"username\":\"alice\"}\n"},
+		{"?pretty=0", "{\"rank\":1,\"username\":\"alice\"}\n"},
+		{"?pretty=1", "{\n  \"rank\": 1,\n  \"username\": \"alice\"\n}\n"},
+		{"?pretty=true", "{\n  \"rank\": 1,\n  \"username\": \"alice\"\n}\n"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		writeResponse(rec, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil), http.StatusOK, payload)
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("%q: body %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	a := newTestApp(t, testSeeds(3), nil)
+	compact := serve(a, http.MethodGet, "/leaderboard", "", nil).Body.String()
+	pretty := serve(a, http.MethodGet, "/leaderboard?pretty=1", "", nil).Body.String()
+	if strings.Count(compact, "\n") != 1 || !strings.Contains(pretty, "\n  \"entries\": [") {
+		t.Fatalf("compact %q, pretty %q", compact, pretty)
+	}
+	var fromCompact, fromPretty LeaderboardResponse
+	if err := json.Unmarshal([]byte(compact), &fromCompact); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(pretty), &fromPretty); err != nil {
+		t.Fatal(err)
+	}
+	if len(compact) >= len(pretty) || len(fromCompact.Entries) != len(fromPretty.Entries) {
+		t.Fatalf("compact body (%d bytes, %d entries) should be smaller than pretty (%d bytes, %d entries)", len(compact), len(fromCompact.Entries), len(pretty), len(fromPretty.Entries))
+	}
+}
+
+func TestStrictPageParamsRejections(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"page=0", "page must be at least 1, got 0"},
+		{"page=-4", "page must be at least 1, got -4"},
+		{"limit=0", "limit must be positive, got 0"},
+		{"limit=-1", "limit must be positive, got -1"},
+		{"limit=201", "limit must be at most 200, got 201"},
+		{"page=two", `page must be an integer, got "two"`},
+		{"limit=1.5", `limit must be an integer, got "1.5"`},
+	}
+	for _, path := range []string{"/leaderboard", "/search?q=user", "/users", "/users/by-rating?rating=4000"} {
+		for _, tt := range tests {
+			sep := "?"
+			if strings.Contains(path, "?") {
+				sep = "&"
+			}
+			target := path + sep + tt.query
+			rec := serve(a, http.MethodGet, target+"&strict=1", "", nil)
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("%s: %v", target, err)
+			}
+			if rec.Code != http.StatusBadRequest || body["error"] != tt.want {
+				t.Errorf("%s strict: got %d %q, want 400 %q", target, rec.Code, body["error"], tt.want)
+			}
+			if rec := serve(a, http.MethodGet, target, "", nil); rec.Code != http.StatusOK {
+				t.Errorf("%s lenient: got %d, want 200", target, rec.Code)
+			}
+		}
+	}
+}
+
+func TestNotModifiedSince(t *testing.T) {
+	last := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		last   time.Time
+		header http.Header
+		want   bool
+	}{
+		{"no validator", last, nil, false},
+		{"client is current", last, http.Header{"If-Modified-Since": {last.Format(http.TimeFormat)}}, true},
+		{"client is ahead", last, http.Header{"If-Modified-Since": {last.Add(time.Minute).Format(http.TimeFormat)}}, true},
+		{"client is stale", last, http.Header{"If-Modified-Since": {last.Add(-time.Second).Format(http.TimeFormat)}}, false},
+		{"unparseable date", last, http.Header{"If-Modified-Since": {"yesterday"}}, false},
+		{"etag takes precedence", last, http.Header{"If-Modified-Since": {last.Format(http.TimeFormat)}, "If-None-Match": {`"other"`}}, false},
+		{"no snapshot yet", time.Time{}, http.Header{"If-Modified-Since": {last.Format(http.TimeFormat)}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/leaderboard", nil)
+			req.Header = tt.header
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			rec := httptest.NewRecorder()
+			if got := notModifiedSince(rec, req, tt.last); got != tt.want {
+				t.Fatalf("notModifiedSince = %v, want %v", got, tt.want)
+			}
+			if tt.want && rec.Code != http.StatusNotModified {
+				t.Fatalf("status %d, want 304", rec.Code)
+			}
+			wantHeader := ""
+			if !tt.last.IsZero() {
+				wantHeader = tt.last.Format(http.TimeFormat)
+			}
+			if got := rec.Header().Get("Last-Modified"); got != wantHeader {
+				t.Fatalf("Last-Modified %q, want %q", got, wantHeader)
+			}
+		})
+	}
+}
+
+func TestClampLimit(t *testing.T) {
+	const fallback, max = 20, 200
+	tests := []struct {
+		limit, want int
+	}{
+		{-1, fallback},
+		{0, fallback},
+		{1, 1},
+		{max - 1, max - 1},
+		{max, max},
+		{max + 1, max},
+		{1 << 30, max},
+	}
+	for _, tt := range tests {
+		if got := clampLimit(tt.limit, fallback, max); got != tt.want {
+			t.Errorf("clampLimit(%d, %d, %d) = %d, want %d", tt.limit, fallback, max, got, tt.want)
+		}
+	}
+}
+
+func TestMaxPageSizeConfig(t *testing.T) {
+	a := newTestApp(t, testSeeds(20), func(cfg *Config) { cfg.MaxPageSize = 5 })
+	tests := []struct {
+		limit string
+		want  int
+	}{
+		{"0", 5},
+		{"1", 1},
+		{"5", 5},
+		{"6", 5},
+	}
+	for _, target := range []string{"/leaderboard", "/search?q=user"} {
+		for _, tt := range tests {
+			sep := "?"
+			if strings.Contains(target, "?") {
+				sep = "&"
+			}
+			var body struct {
+				Entries []LeaderboardEntry `json:"entries"`
+				Results []LeaderboardEntry `json:"results"`
+			}
+			if err := json.Unmarshal(serve(a, http.MethodGet, target+sep+"limit="+tt.limit, "", nil).Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(body.Entries) + len(body.Results); got != tt.want {
+				t.Errorf("%s limit=%s: %d entries, want %d", target, tt.limit, got, tt.want)
+			}
+		}
+	}
+}
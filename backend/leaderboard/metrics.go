@@ -0,0 +1,66 @@
+package leaderboard
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writePrometheus renders the service metrics in the Prometheus text
+// exposition format (version 0.0.4).
+func writePrometheus(w io.Writer, a *app) error {
+	buf := bufio.NewWriter(w)
+	store := a.store
+
+	fmt.Fprintln(buf, "# HELP leaderboard_http_requests_total HTTP requests received, by route pattern.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_http_requests_total counter")
+	counts := a.endpoints.Snapshot()
+	endpoints := make([]string, 0, len(counts))
+	for endpoint := range counts {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(buf, "leaderboard_http_requests_total{endpoint=\"%s\"} %d\n", prometheusLabelEscaper.Replace(endpoint), counts[endpoint])
+	}
+
+	fmt.Fprintln(buf, "# HELP leaderboard_total_users Users currently on the leaderboard.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_total_users gauge")
+	fmt.Fprintf(buf, "leaderboard_total_users %d\n", store.UserCount())
+
+	fmt.Fprintln(buf, "# HELP leaderboard_snapshot_age_seconds Seconds since the last rating change.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_snapshot_age_seconds gauge")
+	fmt.Fprintf(buf, "leaderboard_snapshot_age_seconds %g\n", time.Since(store.LastUpdate()).Seconds())
+
+	fmt.Fprintln(buf, "# HELP leaderboard_rating_updates_total Rating changes applied since start.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_rating_updates_total counter")
+	fmt.Fprintf(buf, "leaderboard_rating_updates_total %d\n", store.UpdatesApplied())
+
+	fmt.Fprintln(buf, "# HELP leaderboard_snapshots_built_total Snapshots published since start.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_snapshots_built_total counter")
+	fmt.Fprintf(buf, "leaderboard_snapshots_built_total %d\n", store.SnapshotsBuilt())
+
+	timings := store.Timings()
+	fmt.Fprintln(buf, "# HELP leaderboard_snapshot_build_seconds Duration of the latest snapshot build.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_snapshot_build_seconds gauge")
+	fmt.Fprintf(buf, "leaderboard_snapshot_build_seconds %g\n", timings.LastSnapshotBuildMs/1000)
+
+	fmt.Fprintln(buf, "# HELP leaderboard_snapshot_build_avg_seconds Mean duration of the recent snapshot builds.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_snapshot_build_avg_seconds gauge")
+	fmt.Fprintf(buf, "leaderboard_snapshot_build_avg_seconds %g\n", timings.AvgSnapshotBuildMs/1000)
+
+	fmt.Fprintln(buf, "# HELP leaderboard_rating_update_avg_seconds Mean time per rating update over the recent update batches.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_rating_update_avg_seconds gauge")
+	fmt.Fprintf(buf, "leaderboard_rating_update_avg_seconds %g\n", timings.AvgUpdateLatencyUs/1e6)
+
+	fmt.Fprintln(buf, "# HELP leaderboard_rating_updates_per_second Random rating updates applied per second, over the last few seconds.")
+	fmt.Fprintln(buf, "# TYPE leaderboard_rating_updates_per_second gauge")
+	fmt.Fprintf(buf, "leaderboard_rating_updates_per_second %g\n", timings.UpdatesPerSecond)
+
+	return buf.Flush()
+}
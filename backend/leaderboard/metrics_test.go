@@ -0,0 +1,66 @@
+package leaderboard
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMetricsScrape(t *testing.T) {
+	a := newTestApp(t, testSeeds(25), nil)
+	for _, target := range []string{"/leaderboard", "/leaderboard?page=2", "/user/user_001", "/user/user_002", "/no/such/route"} {
+		serve(a, http.MethodGet, target, "", nil)
+	}
+
+	rec := serve(a, http.MethodGet, "/metrics", "", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("got %d with Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	described := make(map[string]bool)
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, kind, _ := strings.Cut(rest, " ")
+			if kind != "counter" && kind != "gauge" {
+				t.Fatalf("%s has type %q", name, kind)
+			}
+			described[name] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		series, raw, ok := strings.Cut(line, " ")
+		value, err := strconv.ParseFloat(raw, 64)
+		if !ok || err != nil {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		name, _, _ := strings.Cut(series, "{")
+		if !described[name] {
+			t.Fatalf("sample %q comes before its # TYPE line", line)
+		}
+		samples[series] = value
+	}
+
+	want := map[string]float64{
+		`leaderboard_total_users`:                                      25,
+		`leaderboard_http_requests_total{endpoint="/leaderboard"}`:     2,
+		`leaderboard_http_requests_total{endpoint="/user/{username}"}`: 2,
+		`leaderboard_http_requests_total{endpoint="/"}`:                1,
+	}
+	for series, value := range want {
+		if got, ok := samples[series]; !ok || got != value {
+			t.Errorf("%s = %v (present %v), want %v", series, got, ok, value)
+		}
+	}
+	for _, name := range []string{"leaderboard_rating_updates_total", "leaderboard_snapshots_built_total", "leaderboard_snapshot_build_seconds"} {
+		if _, ok := samples[name]; !ok {
+			t.Errorf("%s is missing", name)
+		}
+	}
+}
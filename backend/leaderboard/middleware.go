@@ -0,0 +1,519 @@
+package leaderboard
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rateWindowSeconds = 10
+	gzipMinSize       = 1024
+
+	// corsAllowMethods and corsAllowHeaders are what a preflight is told
+	// the API accepts, whatever the browser asked for.
+	corsAllowMethods = "GET, HEAD, POST, PUT, DELETE, OPTIONS"
+	corsAllowHeaders = "Accept, Authorization, Content-Type, If-Modified-Since, If-None-Match, traceparent"
+)
+
+// rateCounter counts events per wall-clock second over a short ring so a
+// recent rate can be read without keeping individual timestamps.
+type rateCounter struct {
+	mu      sync.Mutex
+	total   uint64
+	seconds [rateWindowSeconds]int64
+	counts  [rateWindowSeconds]uint64
+}
+
+func (c *rateCounter) Add(now time.Time) {
+	c.AddN(now, 1)
+}
+
+// AddN counts n events at once, for callers that tally a batch.
+func (c *rateCounter) AddN(now time.Time, n uint64) {
+	sec := now.Unix()
+	idx := sec % rateWindowSeconds
+	c.mu.Lock()
+	if c.seconds[idx] != sec {
+		c.seconds[idx] = sec
+		c.counts[idx] = 0
+	}
+	c.counts[idx] += n
+	c.total += n
+	c.mu.Unlock()
+}
+
+func (c *rateCounter) Total() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// Rate averages the completed seconds in the window, or fewer when the
+// process has been up for less than the window.
+func (c *rateCounter) Rate(now time.Time, since time.Time) float64 {
+	current := now.Unix()
+	window := int64(rateWindowSeconds)
+	if up := current - since.Unix(); up < window {
+		window = up
+	}
+	if window <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var sum uint64
+	for i := range c.seconds {
+		if c.seconds[i] < current && c.seconds[i] >= current-window {
+			sum += c.counts[i]
+		}
+	}
+	return float64(sum) / float64(window)
+}
+
+func (a *app) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) != 1 {
+			writeError(w, r, http.StatusUnauthorized, "invalid or missing admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// getOrHead limits a handler to GET and HEAD. HEAD runs the GET handler
+// with the body counted and discarded, so the response carries the same
+// headers, including an exact Content-Length.
+func getOrHead(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			next(w, r)
+		case http.MethodHead:
+			head := &headResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next(head, r)
+			if head.status != http.StatusNotModified && head.status != http.StatusNoContent {
+				w.Header().Set("Content-Length", strconv.Itoa(head.size))
+			}
+			w.WriteHeader(head.status)
+		default:
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+type headResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (h *headResponseWriter) WriteHeader(status int) {
+	if h.size == 0 {
+		h.status = status
+	}
+}
+
+func (h *headResponseWriter) Write(p []byte) (int, error) {
+	h.size += len(p)
+	return len(p), nil
+}
+
+// endpointCounter counts requests per route pattern. Patterns come from the
+// mux, so the label set stays bounded however many distinct paths arrive.
+type endpointCounter struct {
+	counts sync.Map
+}
+
+func (c *endpointCounter) Add(endpoint string) {
+	value, ok := c.counts.Load(endpoint)
+	if !ok {
+		value, _ = c.counts.LoadOrStore(endpoint, new(atomic.Uint64))
+	}
+	value.(*atomic.Uint64).Add(1)
+}
+
+// Snapshot returns the current count for every endpoint seen so far.
+func (c *endpointCounter) Snapshot() map[string]uint64 {
+	counts := make(map[string]uint64)
+	c.counts.Range(func(key, value any) bool {
+		counts[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
+
+// routePattern is the mux pattern r matches, such as "/user/{username}", or
+// "" when none does. Metrics and traces label requests with it rather than
+// the raw path, which would give every username its own series.
+func (a *app) routePattern(r *http.Request) string {
+	_, pattern := a.mux.Handler(r)
+	return pattern
+}
+
+func (a *app) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.requests.Add(time.Now())
+		endpoint := "unmatched"
+		if pattern := a.routePattern(r); pattern != "" {
+			endpoint = pattern
+		}
+		a.endpoints.Add(endpoint)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newLogger builds the structured logger for request and lifecycle logs.
+func newLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// logRequests emits one structured line per request once it completes.
+// Bytes are counted as written to the client, after compression.
+func (a *app) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		a.logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", recorder.size),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	})
+}
+
+// isProbePath reports whether path is a health probe, which maintenance
+// mode and rate limiting leave alone.
+func isProbePath(path string) bool {
+	return path == "/health" || path == "/healthz" || path == "/readyz"
+}
+
+func (a *app) withMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.maintenance.Load() || isProbePath(r.URL.Path) || r.URL.Path == "/status" || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(a.retryAfter))
+		writeError(w, r, http.StatusServiceUnavailable, "service is under maintenance, please retry later")
+	})
+}
+
+// requestTimeoutBody has writeError's shape, since http.TimeoutHandler
+// writes its message as-is.
+const requestTimeoutBody = `{"error":"request timed out"}` + "\n"
+
+// withTimeout answers 503 once a request has run for a.requestTimeout and
+// cancels its context, so scans that watch it can stop early. Streaming and
+// upgraded requests are passed straight through: http.TimeoutHandler buffers
+// the response and can neither flush nor hijack it.
+func (a *app) withTimeout(next http.Handler) http.Handler {
+	if a.requestTimeout <= 0 {
+		return next
+	}
+	timeout := http.TimeoutHandler(next, a.requestTimeout, requestTimeoutBody)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreamingRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		timeout.ServeHTTP(timeoutJSONWriter{ResponseWriter: w, vary: w.Header().Values("Vary")}, r)
+	})
+}
+
+func isStreamingRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/leaderboard/stream", "/ws", "/export.ndjson", "/leaderboard.sql":
+		return true
+	case "/search":
+		return wantsSearchStream(r)
+	}
+	return r.Header.Get("Upgrade") != ""
+}
+
+// timeoutJSONWriter labels http.TimeoutHandler's 503 body as JSON; a 503
+// from the handler itself already carries its own Content-Type. The
+// TimeoutHandler copies the handler's headers over the outer ones, so a
+// Vary set by the handler would drop the one withGzip and withCORS added;
+// vary holds those and WriteHeader puts them back.
+type timeoutJSONWriter struct {
+	http.ResponseWriter
+	vary []string
+}
+
+func (w timeoutJSONWriter) WriteHeader(status int) {
+	header := w.Header()
+	if status == http.StatusServiceUnavailable && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	current := header.Values("Vary")
+	for i := len(w.vary) - 1; i >= 0; i-- {
+		if !slices.Contains(current, w.vary[i]) {
+			current = append([]string{w.vary[i]}, current...)
+		}
+	}
+	if len(current) > 0 {
+		header["Vary"] = current
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// withCORS allows every origin with "*" unless an allow-list is configured,
+// in which case only listed origins are echoed back and others get no
+// Access-Control-Allow-Origin header at all. Preflights are answered with
+// the fixed method and header sets rather than an echo of the request.
+func (a *app) withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(a.corsOrigins) == 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origin != "" {
+				if _, ok := a.corsOrigins[origin]; ok {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+		w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+		w.Header().Set("Access-Control-Max-Age", "600")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withGzip compresses responses for clients that accept gzip. Output is
+// held back until gzipMinSize bytes arrive, so small bodies like /health go
+// out as-is. A Flush before that point commits to an uncompressed response,
+// which keeps streaming endpoints unbuffered.
+func withGzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header lists gzip with a
+// non-zero quality.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			value, ok := strings.CutPrefix(strings.TrimSpace(param), "q=")
+			if !ok {
+				continue
+			}
+			if q, err := strconv.ParseFloat(value, 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	buf       []byte
+	gz        *gzip.Writer
+	committed bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if !g.committed {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.committed {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= gzipMinSize {
+		if err := g.commit(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// commit sends the status line and anything buffered, compressed or not.
+// Bodiless statuses and responses that already carry an encoding are never
+// compressed.
+func (g *gzipResponseWriter) commit(compress bool) error {
+	g.committed = true
+	header := g.Header()
+	if header.Get("Content-Encoding") != "" || g.status < 200 || g.status == http.StatusNoContent || g.status == http.StatusNotModified {
+		compress = false
+	}
+	if compress {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		g.ResponseWriter.WriteHeader(g.status)
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+		_, err := g.gz.Write(g.buf)
+		g.buf = nil
+		return err
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	var err error
+	if len(g.buf) > 0 {
+		_, err = g.ResponseWriter.Write(g.buf)
+	}
+	g.buf = nil
+	return err
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if !g.committed {
+		_ = g.commit(false)
+	}
+	if g.gz != nil {
+		_ = g.gz.Flush()
+	}
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (g *gzipResponseWriter) Close() error {
+	if !g.committed {
+		return g.commit(false)
+	}
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+	return nil
+}
+
+// withRecovery turns a handler panic into a logged stack trace and a 500
+// so one bad request cannot take the process down. http.ErrAbortHandler is
+// re-raised, since net/http uses it to abort a response on purpose.
+func (a *app) withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			a.logger.Error("panic serving request",
+				"method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+			writeError(w, r, http.StatusInternalServerError, "internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func stripAPIPrefix(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api") {
+			clone := r.Clone(r.Context())
+			trimmed := strings.TrimPrefix(clone.URL.Path, "/api")
+			if trimmed == "" {
+				trimmed = "/"
+			}
+			clone.URL.Path = trimmed
+			next.ServeHTTP(w, clone)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.size += n
+	return n, err
+}
+
+// Hijack lets WebSocket upgrades through the recorder. The upgraded
+// connection writes its own 101 response, so it is recorded here.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", r.ResponseWriter)
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
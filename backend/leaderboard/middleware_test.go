@@ -0,0 +1,305 @@
+package leaderboard
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+	a := newTestApp(t, testSeeds(200), nil)
+	plain := serve(a, http.MethodGet, "/leaderboard?limit=100", "", nil)
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("compressed without Accept-Encoding: %q", plain.Header().Get("Content-Encoding"))
+	}
+	if plain.Body.Len() < gzipMinSize {
+		t.Fatalf("page is only %d bytes, below the %d byte threshold", plain.Body.Len(), gzipMinSize)
+	}
+
+	compressed := serve(a, http.MethodGet, "/leaderboard?limit=100", "", http.Header{"Accept-Encoding": {"gzip"}})
+	if compressed.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", compressed.Header().Get("Content-Encoding"))
+	}
+	if vary := compressed.Header().Values("Vary"); !containsToken(vary, "Accept-Encoding") {
+		t.Fatalf("Vary = %v, want Accept-Encoding", vary)
+	}
+	reader, err := gzip.NewReader(compressed.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, plain.Body.Bytes()) {
+		t.Fatalf("decompressed body differs from the plain one:\n%s\nvs\n%s", body, plain.Body)
+	}
+
+	small := serve(a, http.MethodGet, "/health", "", http.Header{"Accept-Encoding": {"gzip"}})
+	if small.Body.Len() >= gzipMinSize {
+		t.Fatalf("/health is %d bytes, not below the threshold", small.Body.Len())
+	}
+	if small.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("a %d byte body was compressed", small.Body.Len())
+	}
+}
+
+// bufferLogger returns a JSON logger writing into buf at debug level.
+func bufferLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestLogRequests(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	var buf bytes.Buffer
+	a.logger = bufferLogger(&buf)
+
+	rec := serve(a, http.MethodGet, "/api/health", "", nil)
+	var line struct {
+		Level      string  `json:"level"`
+		Msg        string  `json:"msg"`
+		Method     string  `json:"method"`
+		Path       string  `json:"path"`
+		Status     int     `json:"status"`
+		Bytes      int     `json:"bytes"`
+		DurationMs float64 `json:"duration_ms"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log output %q is not one JSON line: %v", buf.String(), err)
+	}
+	if line.Level != "INFO" || line.Msg != "request" || line.Method != http.MethodGet || line.Path != "/api/health" {
+		t.Fatalf("logged %+v", line)
+	}
+	if line.Status != http.StatusOK || line.Bytes != rec.Body.Len() || line.DurationMs < 0 {
+		t.Fatalf("logged status %d, %d bytes, %gms; response was %d with %d bytes", line.Status, line.Bytes, line.DurationMs, rec.Code, rec.Body.Len())
+	}
+
+	buf.Reset()
+	serve(a, http.MethodGet, "/user/nobody", "", nil)
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || line.Status != http.StatusNotFound {
+		t.Fatalf("404 logged as %q", buf.String())
+	}
+
+	buf.Reset()
+	a.logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	serve(a, http.MethodGet, "/health", "", nil)
+	if buf.Len() != 0 {
+		t.Fatalf("request logged above its level: %q", buf.String())
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "text", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "key", "value")
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=WARN msg=shown key=value") {
+		t.Fatalf("text logger wrote %q", got)
+	}
+	for _, bad := range [][2]string{{"xml", "info"}, {"json", "loud"}} {
+		if _, err := newLogger(&buf, bad[0], bad[1]); err == nil {
+			t.Fatalf("format %q, level %q: no error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestWithRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	a := &app{logger: bufferLogger(&buf)}
+	handler := a.withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/panic":
+			panic("boom")
+		case "/abort":
+			panic(http.ErrAbortHandler)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/panic")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("panicking handler: got %d, want 500", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == "" {
+		t.Fatalf("500 body %q is not a JSON error", rec.Body)
+	}
+	var logged map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &logged); err != nil || logged["panic"] != "boom" || logged["path"] != "/panic" || !strings.Contains(logged["stack"], "goroutine") {
+		t.Fatalf("panic logged as %q", buf.String())
+	}
+	if rec := get("/ok"); rec.Code != http.StatusNoContent {
+		t.Fatalf("request after the panic: got %d, want 204", rec.Code)
+	}
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != http.ErrAbortHandler {
+				t.Fatalf("recovered %v, want http.ErrAbortHandler re-raised", recovered)
+			}
+		}()
+		get("/abort")
+	}()
+}
+
+func TestWithCORS(t *testing.T) {
+	const allowed, other = "https://app.example.com", "https://evil.example.com"
+	tests := []struct {
+		name       string
+		origins    []string
+		origin     string
+		wantOrigin string
+		wantVary   bool
+	}{
+		{"wildcard", nil, other, "*", false},
+		{"allowed", []string{allowed}, allowed, allowed, true},
+		{"disallowed", []string{allowed}, other, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, testSeeds(5), func(cfg *Config) { cfg.CORSOrigins = tt.origins })
+			preflight := http.Header{
+				"Origin":                         {tt.origin},
+				"Access-Control-Request-Method":  {"PATCH"},
+				"Access-Control-Request-Headers": {"X-Anything"},
+			}
+			for _, req := range []struct {
+				method string
+				header http.Header
+				status int
+			}{
+				{http.MethodGet, http.Header{"Origin": {tt.origin}}, http.StatusOK},
+				{http.MethodOptions, preflight, http.StatusNoContent},
+			} {
+				rec := serve(a, req.method, "/leaderboard", "", req.header)
+				if rec.Code != req.status {
+					t.Fatalf("%s: got %d, want %d", req.method, rec.Code, req.status)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+					t.Fatalf("%s: Access-Control-Allow-Origin = %q, want %q", req.method, got, tt.wantOrigin)
+				}
+				if vary := containsToken(rec.Header().Values("Vary"), "Origin"); vary != tt.wantVary {
+					t.Fatalf("%s: Vary: Origin present %v, want %v", req.method, vary, tt.wantVary)
+				}
+				if req.method != http.MethodOptions {
+					continue
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Methods"); got != corsAllowMethods {
+					t.Fatalf("preflight Access-Control-Allow-Methods = %q, want %q", got, corsAllowMethods)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Headers"); got != corsAllowHeaders {
+					t.Fatalf("preflight Access-Control-Allow-Headers = %q, want %q", got, corsAllowHeaders)
+				}
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	a := &app{requestTimeout: 20 * time.Millisecond}
+	canceled := make(chan bool, 1)
+	handler := a.withTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			canceled <- true
+		case <-time.After(100 * time.Millisecond):
+			canceled <- false
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/leaderboard", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("slow request: got %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" || rec.Body.String() != requestTimeoutBody {
+		t.Fatalf("timeout response: Content-Type %q, body %q", rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if !<-canceled {
+		t.Fatal("the slow handler's context was not canceled")
+	}
+
+	for _, target := range []string{"/leaderboard/stream", "/export.ndjson", "/search?q=user&stream=1"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("streaming %s: got %d, want 200 past the timeout", target, rec.Code)
+		}
+		if <-canceled {
+			t.Fatalf("streaming %s was canceled by the timeout", target)
+		}
+	}
+}
+
+func containsToken(values []string, token string) bool {
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if strings.TrimSpace(part) == token {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestGetOrHead(t *testing.T) {
+	a := newTestApp(t, testSeeds(30), nil)
+	for _, target := range []string{"/leaderboard?limit=25", "/search?q=user_01"} {
+		get := serve(a, http.MethodGet, target, "", nil)
+		head := serve(a, http.MethodHead, target, "", nil)
+		if head.Code != http.StatusOK || head.Body.Len() != 0 {
+			t.Fatalf("HEAD %s: got %d with %d body bytes", target, head.Code, head.Body.Len())
+		}
+		if got, want := head.Header().Get("Content-Length"), strconv.Itoa(get.Body.Len()); got != want {
+			t.Fatalf("HEAD %s: Content-Length %q, want %s", target, got, want)
+		}
+		for _, key := range []string{"Content-Type", "ETag", "Last-Modified"} {
+			if head.Header().Get(key) != get.Header().Get(key) {
+				t.Fatalf("HEAD %s: %s %q, GET sent %q", target, key, head.Header().Get(key), get.Header().Get(key))
+			}
+		}
+	}
+
+	etag := serve(a, http.MethodGet, "/leaderboard", "", nil).Header().Get("ETag")
+	rec := serve(a, http.MethodHead, "/leaderboard", "", http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusNotModified || rec.Header().Get("Content-Length") != "" {
+		t.Fatalf("conditional HEAD: got %d with Content-Length %q", rec.Code, rec.Header().Get("Content-Length"))
+	}
+
+	tests := []struct {
+		method, target, allow string
+	}{
+		{http.MethodPost, "/leaderboard", "GET, HEAD"},
+		{http.MethodPut, "/leaderboard", "GET, HEAD"},
+		{http.MethodDelete, "/leaderboard", "GET, HEAD"},
+		{http.MethodPut, "/search?q=user", "GET, HEAD, POST"},
+		{http.MethodPatch, "/search?q=user", "GET, HEAD, POST"},
+	}
+	for _, tt := range tests {
+		rec := serve(a, tt.method, tt.target, "", nil)
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.target, err)
+		}
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != tt.allow || body["error"] != "method not allowed" {
+			t.Fatalf("%s %s: got %d, Allow %q, body %v; want 405, Allow %q", tt.method, tt.target, rec.Code, rec.Header().Get("Allow"), body, tt.allow)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package leaderboard
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	moverWindow = 10000
+	maxMovers   = 100
+)
+
+type ratingMove struct {
+	id        int
+	oldRating int32
+	newRating int32
+}
+
+// moveLog keeps the most recent rating changes in a fixed ring. It has its
+// own mutex so recording a change never waits on readers of the ring.
+type moveLog struct {
+	mu    sync.Mutex
+	moves [moverWindow]ratingMove
+	next  int
+	count int
+}
+
+func (l *moveLog) record(id int, oldRating int, newRating int) {
+	l.mu.Lock()
+	l.moves[l.next] = ratingMove{id: id, oldRating: int32(oldRating), newRating: int32(newRating)}
+	l.next = (l.next + 1) % moverWindow
+	if l.count < moverWindow {
+		l.count++
+	}
+	l.mu.Unlock()
+}
+
+// TopMovers nets each user's rating changes across the last moverWindow
+// updates, from their first old rating to their latest new one, and returns
+// the biggest gainers, or the biggest losers when up is false. Users whose
+// net change is zero or in the other direction are left out, as are users
+// removed since they moved.
+func (s *Store) TopMovers(limit int, up bool) []MoverEntry {
+	if limit <= 0 {
+		return []MoverEntry{}
+	}
+
+	type net struct {
+		oldRating int32
+		newRating int32
+	}
+	s.moves.mu.Lock()
+	nets := make(map[int]*net, s.moves.count)
+	start := (s.moves.next - s.moves.count + moverWindow) % moverWindow
+	for i := 0; i < s.moves.count; i++ {
+		move := s.moves.moves[(start+i)%moverWindow]
+		if n, ok := nets[move.id]; ok {
+			n.newRating = move.newRating
+			continue
+		}
+		nets[move.id] = &net{oldRating: move.oldRating, newRating: move.newRating}
+	}
+	s.moves.mu.Unlock()
+
+	table := s.loadTable()
+	movers := make([]MoverEntry, 0, len(nets))
+	for id, n := range nets {
+		delta := int(n.newRating - n.oldRating)
+		if delta == 0 || (delta > 0) != up {
+			continue
+		}
+		username := table.users[id].Username
+		if current, ok := table.findID(username); !ok || current != id {
+			continue
+		}
+		movers = append(movers, MoverEntry{
+			Username:  username,
+			OldRating: int(n.oldRating),
+			NewRating: int(n.newRating),
+			Delta:     delta,
+		})
+	}
+
+	sort.Slice(movers, func(i, j int) bool {
+		if movers[i].Delta != movers[j].Delta {
+			if up {
+				return movers[i].Delta > movers[j].Delta
+			}
+			return movers[i].Delta < movers[j].Delta
+		}
+		return movers[i].Username < movers[j].Username
+	})
+	if len(movers) > limit {
+		movers = movers[:limit]
+	}
+	return movers
+}
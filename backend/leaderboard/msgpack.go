@@ -0,0 +1,148 @@
+package leaderboard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const msgpackContentType = "application/msgpack"
+
+// acceptsMsgpack reports whether the client asked for MessagePack, under
+// either its registered or its older x- media type.
+func acceptsMsgpack(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, msgpackContentType) || strings.Contains(accept, "application/x-msgpack")
+}
+
+// appendMsgpackFromJSON transcodes one JSON document to MessagePack,
+// appending it to dst. Objects keep their key order. Integers that fit an
+// int64 or uint64 are packed as integers and every other number as a
+// float64.
+func appendMsgpackFromJSON(dst []byte, data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return appendMsgpackValue(dst, dec)
+}
+
+func appendMsgpackValue(dst []byte, dec *json.Decoder) ([]byte, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		// Container headers carry the element count, so elements are
+		// packed into their own buffer first.
+		var body []byte
+		count := 0
+		for dec.More() {
+			if value == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				body = appendMsgpackString(body, key.(string))
+			}
+			if body, err = appendMsgpackValue(body, dec); err != nil {
+				return nil, err
+			}
+			count++
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		if value == '{' {
+			dst = appendMsgpackHeader(dst, count, 0x80, 0xde)
+		} else {
+			dst = appendMsgpackHeader(dst, count, 0x90, 0xdc)
+		}
+		return append(dst, body...), nil
+	case string:
+		return appendMsgpackString(dst, value), nil
+	case json.Number:
+		return appendMsgpackNumber(dst, value)
+	case bool:
+		if value {
+			return append(dst, 0xc3), nil
+		}
+		return append(dst, 0xc2), nil
+	case nil:
+		return append(dst, 0xc0), nil
+	default:
+		return nil, fmt.Errorf("unexpected JSON token %v", token)
+	}
+}
+
+// appendMsgpackHeader writes a map or array header: the fix form for fewer
+// than 16 elements, then the 16- and 32-bit forms, whose type bytes follow
+// wide and wide+1.
+func appendMsgpackHeader(dst []byte, count int, fix byte, wide byte) []byte {
+	switch {
+	case count < 16:
+		return append(dst, fix|byte(count))
+	case count <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, wide), uint16(count))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, wide+1), uint32(count))
+	}
+}
+
+func appendMsgpackString(dst []byte, value string) []byte {
+	switch n := len(value); {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+	}
+	return append(dst, value...)
+}
+
+func appendMsgpackNumber(dst []byte, number json.Number) ([]byte, error) {
+	if value, err := number.Int64(); err == nil {
+		return appendMsgpackInt(dst, value), nil
+	}
+	if value, err := strconv.ParseUint(number.String(), 10, 64); err == nil {
+		return binary.BigEndian.AppendUint64(append(dst, 0xcf), value), nil
+	}
+	value, err := number.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint64(append(dst, 0xcb), math.Float64bits(value)), nil
+}
+
+// appendMsgpackInt packs value in the smallest integer form that holds it.
+func appendMsgpackInt(dst []byte, value int64) []byte {
+	switch {
+	case value >= 0 && value <= math.MaxInt8:
+		return append(dst, byte(value))
+	case value >= -32 && value < 0:
+		return append(dst, byte(value))
+	case value > 0 && value <= math.MaxUint8:
+		return append(dst, 0xcc, byte(value))
+	case value > 0 && value <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xcd), uint16(value))
+	case value > 0 && value <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xce), uint32(value))
+	case value > 0:
+		return binary.BigEndian.AppendUint64(append(dst, 0xcf), uint64(value))
+	case value >= math.MinInt8:
+		return append(dst, 0xd0, byte(value))
+	case value >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xd1), uint16(value))
+	case value >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(value))
+	}
+}
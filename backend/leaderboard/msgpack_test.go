@@ -0,0 +1,190 @@
+package leaderboard
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeMsgpack decodes one MessagePack value the way json.Unmarshal
+// decodes into an any: maps as map[string]any, arrays as []any and every
+// number as a float64. It reads only the forms appendMsgpackFromJSON
+// writes, and returns the bytes left over.
+func decodeMsgpack(data []byte) (any, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end of input")
+	}
+	b, rest := data[0], data[1:]
+	take := func(n int) ([]byte, error) {
+		if len(rest) < n {
+			return nil, fmt.Errorf("type 0x%02x needs %d bytes, %d left", b, n, len(rest))
+		}
+		out := rest[:n]
+		rest = rest[n:]
+		return out, nil
+	}
+	length := func(size int) (int, error) {
+		raw, err := take(size)
+		if err != nil {
+			return 0, err
+		}
+		switch size {
+		case 1:
+			return int(raw[0]), nil
+		case 2:
+			return int(binary.BigEndian.Uint16(raw)), nil
+		default:
+			return int(binary.BigEndian.Uint32(raw)), nil
+		}
+	}
+	str := func(n int) (any, []byte, error) {
+		raw, err := take(n)
+		return string(raw), rest, err
+	}
+	collection := func(n int, isMap bool) (any, []byte, error) {
+		if !isMap {
+			values := make([]any, 0, n)
+			for i := 0; i < n; i++ {
+				value, next, err := decodeMsgpack(rest)
+				if err != nil {
+					return nil, nil, err
+				}
+				values, rest = append(values, value), next
+			}
+			return values, rest, nil
+		}
+		values := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			key, next, err := decodeMsgpack(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			value, next, err := decodeMsgpack(next)
+			if err != nil {
+				return nil, nil, err
+			}
+			values[key.(string)], rest = value, next
+		}
+		return values, rest, nil
+	}
+	fixed := func(size int, convert func([]byte) float64) (any, []byte, error) {
+		raw, err := take(size)
+		if err != nil {
+			return nil, nil, err
+		}
+		return convert(raw), rest, nil
+	}
+
+	switch {
+	case b <= 0x7f:
+		return float64(b), rest, nil
+	case b >= 0xe0:
+		return float64(int8(b)), rest, nil
+	case b&0xf0 == 0x80:
+		return collection(int(b&0x0f), true)
+	case b&0xf0 == 0x90:
+		return collection(int(b&0x0f), false)
+	case b&0xe0 == 0xa0:
+		return str(int(b & 0x1f))
+	}
+	switch b {
+	case 0xc0:
+		return nil, rest, nil
+	case 0xc2:
+		return false, rest, nil
+	case 0xc3:
+		return true, rest, nil
+	case 0xcc:
+		return fixed(1, func(raw []byte) float64 { return float64(raw[0]) })
+	case 0xcd:
+		return fixed(2, func(raw []byte) float64 { return float64(binary.BigEndian.Uint16(raw)) })
+	case 0xce:
+		return fixed(4, func(raw []byte) float64 { return float64(binary.BigEndian.Uint32(raw)) })
+	case 0xcf:
+		return fixed(8, func(raw []byte) float64 { return float64(binary.BigEndian.Uint64(raw)) })
+	case 0xd0:
+		return fixed(1, func(raw []byte) float64 { return float64(int8(raw[0])) })
+	case 0xd1:
+		return fixed(2, func(raw []byte) float64 { return float64(int16(binary.BigEndian.Uint16(raw))) })
+	case 0xd2:
+		return fixed(4, func(raw []byte) float64 { return float64(int32(binary.BigEndian.Uint32(raw))) })
+	case 0xd3:
+		return fixed(8, func(raw []byte) float64 { return float64(int64(binary.BigEndian.Uint64(raw))) })
+	case 0xcb:
+		return fixed(8, func(raw []byte) float64 { return math.Float64frombits(binary.BigEndian.Uint64(raw)) })
+	case 0xd9, 0xda, 0xdb:
+		n, err := length(1 << (b - 0xd9))
+		if err != nil {
+			return nil, nil, err
+		}
+		return str(n)
+	case 0xdc, 0xdd, 0xde, 0xdf:
+		n, err := length(2 << ((b - 0xdc) % 2))
+		if err != nil {
+			return nil, nil, err
+		}
+		return collection(n, b >= 0xde)
+	}
+	return nil, nil, fmt.Errorf("unsupported type byte 0x%02x", b)
+}
+
+// assertMsgpackMatchesJSON decodes packed and fails unless it holds the same
+// value as the JSON document.
+func assertMsgpackMatchesJSON(t *testing.T, packed []byte, document []byte) {
+	t.Helper()
+	got, rest, err := decodeMsgpack(packed)
+	if err != nil {
+		t.Fatalf("decoding MessagePack: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("%d bytes left after the MessagePack value", len(rest))
+	}
+	var want any
+	if err := json.Unmarshal(document, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("MessagePack decodes to\n%v\nJSON holds\n%v", got, want)
+	}
+}
+
+func TestMsgpackFromJSONRoundTrip(t *testing.T) {
+	wideMap := make(map[string]int, 20)
+	for i := range 20 {
+		wideMap[fmt.Sprintf("key_%02d", i)] = i * 1000
+	}
+	wide, _ := json.Marshal(wideMap)
+	documents := []string{
+		`null`, `true`, `false`, `0`, `127`, `128`, `-1`, `-32`, `-33`, `-129`, `-40000`,
+		`255`, `65535`, `65536`, `4294967296`, `-9223372036854775808`, `18446744073709551615`,
+		`1.5`, `-0.25`, `1e300`,
+		`""`, `"` + strings.Repeat("é", 20) + `"`, `"` + strings.Repeat("x", 300) + `"`, `"` + strings.Repeat("y", 70000) + `"`,
+		`[]`, `{}`, `[1, "two", [3], {"four": 4}]`,
+		`[` + strings.TrimSuffix(strings.Repeat(`1,`, 20), ",") + `]`,
+		string(wide),
+	}
+	for _, document := range documents {
+		packed, err := appendMsgpackFromJSON(nil, []byte(document))
+		if err != nil {
+			t.Fatalf("%.40s: %v", document, err)
+		}
+		assertMsgpackMatchesJSON(t, packed, []byte(document))
+	}
+}
+
+func TestMsgpackResponsesMatchJSON(t *testing.T) {
+	a := newTestApp(t, testSeeds(40), nil)
+	for _, target := range []string{"/leaderboard?limit=30&include_percentile=1", "/stats", "/user/user_003", "/search?q=user_0"} {
+		plain := serve(a, http.MethodGet, target, "", nil)
+		packed := serve(a, http.MethodGet, target, "", http.Header{"Accept": {msgpackContentType}})
+		if packed.Code != http.StatusOK || packed.Header().Get("Content-Type") != msgpackContentType {
+			t.Fatalf("%s: got %d with Content-Type %q", target, packed.Code, packed.Header().Get("Content-Type"))
+		}
+		assertMsgpackMatchesJSON(t, packed.Body.Bytes(), plain.Body.Bytes())
+	}
+}
@@ -0,0 +1,66 @@
+package leaderboard
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Pooled values larger than these are dropped instead of returned, so one
+// oversized response doesn't pin its memory for the life of the process.
+const (
+	maxPooledEntries     = 1000
+	maxPooledBufferBytes = 64 << 10
+)
+
+var entryPool = sync.Pool{
+	New: func() any {
+		entries := make([]LeaderboardEntry, 0, 20)
+		return &entries
+	},
+}
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// getEntries returns an empty entry slice for one request. Whatever is
+// built on it must be finished with, including being encoded, before
+// putEntries hands it back.
+func getEntries() *[]LeaderboardEntry {
+	entries := entryPool.Get().(*[]LeaderboardEntry)
+	*entries = (*entries)[:0]
+	return entries
+}
+
+func putEntries(entries *[]LeaderboardEntry) {
+	if cap(*entries) > maxPooledEntries {
+		return
+	}
+	entryPool.Put(entries)
+}
+
+// growEntries returns dst with room for n more entries, allocating only when
+// its capacity falls short.
+func growEntries(dst []LeaderboardEntry, n int) []LeaderboardEntry {
+	if cap(dst)-len(dst) >= n {
+		return dst
+	}
+	grown := make([]LeaderboardEntry, len(dst), len(dst)+n)
+	copy(grown, dst)
+	return grown
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferBytes {
+		return
+	}
+	bufferPool.Put(buf)
+}
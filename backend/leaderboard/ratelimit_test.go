@@ -0,0 +1,103 @@
+package leaderboard
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterExhaustsAndRecovers(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+	start := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("client", start); !ok {
+			t.Fatalf("request %d of the burst was refused", i+1)
+		}
+	}
+	ok, wait := limiter.Allow("client", start)
+	if ok {
+		t.Fatal("request past the burst was allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("wait = %v, want 500ms at 2 rps", wait)
+	}
+	if ok, _ := limiter.Allow("other", start); !ok {
+		t.Fatal("another client shared the exhausted bucket")
+	}
+	if ok, _ := limiter.Allow("client", start.Add(wait)); !ok {
+		t.Fatal("request after the advertised wait was refused")
+	}
+	if ok, _ := limiter.Allow("client", start.Add(wait)); ok {
+		t.Fatal("a single refilled token was spent twice")
+	}
+	// A full refill never goes past the burst.
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("client", later); !ok {
+			t.Fatalf("request %d after refilling was refused", i+1)
+		}
+	}
+	if ok, _ := limiter.Allow("client", later); ok {
+		t.Fatal("bucket refilled past its burst")
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	limiter := newRateLimiter(10, 5)
+	start := time.Unix(1_700_000_000, 0)
+	limiter.Allow("idle", start)
+	limiter.Allow("busy", start.Add(rateLimitSweepInterval-time.Millisecond))
+	limiter.Allow("busy", start.Add(rateLimitSweepInterval))
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Fatal("a bucket idle long enough to refill was kept")
+	}
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Fatal("an active bucket was swept")
+	}
+}
+
+func TestLimitRateMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		trust   bool
+		headers []http.Header
+		limited bool
+	}{
+		{"one client", false, []http.Header{nil, nil}, true},
+		{"forwarded ignored", false, []http.Header{{"X-Forwarded-For": {"10.0.0.1"}}, {"X-Forwarded-For": {"10.0.0.2"}}}, true},
+		{"forwarded trusted", true, []http.Header{{"X-Forwarded-For": {"10.0.0.1"}}, {"X-Forwarded-For": {"10.0.0.2"}}}, false},
+		{"spoofed first hop", true, []http.Header{{"X-Forwarded-For": {"1.1.1.1, 10.0.0.1"}}, {"X-Forwarded-For": {"2.2.2.2, 10.0.0.1"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, testSeeds(5), func(cfg *Config) {
+				cfg.RateLimit = 1
+				cfg.RateBurst = 1
+				cfg.TrustForwardedFor = tt.trust
+			})
+			if rec := serve(a, http.MethodGet, "/leaderboard", "", tt.headers[0]); rec.Code != http.StatusOK {
+				t.Fatalf("first request: got %d", rec.Code)
+			}
+			rec := serve(a, http.MethodGet, "/leaderboard", "", tt.headers[1])
+			if limited := rec.Code == http.StatusTooManyRequests; limited != tt.limited {
+				t.Fatalf("second request: got %d, limited %v, want %v", rec.Code, limited, tt.limited)
+			}
+			if tt.limited && rec.Header().Get("Retry-After") != "1" {
+				t.Fatalf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+			}
+			if rec := serve(a, http.MethodGet, "/healthz", "", tt.headers[0]); rec.Code != http.StatusOK {
+				t.Fatalf("probe was limited: got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestRateLimitIsOptIn(t *testing.T) {
+	if cfg := DefaultConfig(); cfg.RateLimit != 0 {
+		t.Fatalf("default RateLimit = %g, want 0", cfg.RateLimit)
+	}
+	a := newTestApp(t, testSeeds(5), func(cfg *Config) { cfg.RateLimit = DefaultConfig().RateLimit })
+	if a.limiter != nil {
+		t.Fatal("a limiter was built without RATE_LIMIT")
+	}
+}
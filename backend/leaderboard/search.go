@@ -0,0 +1,363 @@
+package leaderboard
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+func (s *Store) SearchPage(prefix string, page int, limit int) ([]LeaderboardEntry, int, int, int) {
+	return s.AppendSearchPage(nil, prefix, page, limit)
+}
+
+// AppendSearchPage is SearchPage appending its results to dst, which lets
+// the /search handler fill a pooled slice.
+func (s *Store) AppendSearchPage(dst []LeaderboardEntry, prefix string, page int, limit int) ([]LeaderboardEntry, int, int, int) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if page <= 0 {
+		page = 1
+	}
+	prefix = normalizeUsername(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return nil, 0, page, 0
+	}
+
+	table := s.loadTable()
+	start, end := table.prefixRange(prefix)
+	total := end - start
+	totalPages := calcTotalPages(total, limit)
+	page = clampPage(page, totalPages)
+	if total == 0 {
+		return nil, 0, page, totalPages
+	}
+
+	offset := (page - 1) * limit
+	startIdx := start + offset
+	if startIdx >= end {
+		return nil, total, page, totalPages
+	}
+	endIdx := startIdx + limit
+	if endIdx > end {
+		endIdx = end
+	}
+
+	snap := s.currentSnapshot()
+	results := growEntries(dst, endIdx-startIdx)
+	for i := startIdx; i < endIdx; i++ {
+		results = append(results, s.snapshotEntry(table, snap, table.usernameIndex[i].ID))
+	}
+
+	return results, total, page, totalPages
+}
+
+// ListByUsername pages through every user in username order, straight off
+// the username index, and returns how many users there are. Ranks and
+// ratings come from the current snapshot like search results. A page past
+// the last user is empty, never nil, so it encodes as [].
+func (s *Store) ListByUsername(page int, limit int) ([]LeaderboardEntry, int) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if page <= 0 {
+		page = 1
+	}
+	table := s.loadTable()
+	total := len(table.usernameIndex)
+	offset := (page - 1) * limit
+	if offset >= total {
+		return []LeaderboardEntry{}, total
+	}
+	end := min(offset+limit, total)
+	snap := s.currentSnapshot()
+	results := make([]LeaderboardEntry, 0, end-offset)
+	for _, item := range table.usernameIndex[offset:end] {
+		results = append(results, s.snapshotEntry(table, snap, item.ID))
+	}
+	return results, total
+}
+
+// SearchContains pages through usernames containing substr anywhere, in
+// username order. It is a linear scan, so queries shorter than
+// minContainsLength match nothing and at most searchScanBudget index entries
+// are visited; the last result reports whether that budget, or ctx ending,
+// cut the scan short.
+func (s *Store) SearchContains(ctx context.Context, substr string, page int, limit int) ([]LeaderboardEntry, int, int, int, bool) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if page <= 0 {
+		page = 1
+	}
+	substr = normalizeUsername(strings.TrimSpace(substr))
+	if utf8.RuneCountInString(substr) < minContainsLength {
+		return nil, 0, page, 0, false
+	}
+
+	table := s.loadTable()
+	scan := len(table.usernameIndex)
+	truncated := scan > searchScanBudget
+	if truncated {
+		scan = searchScanBudget
+	}
+	var matches []int
+	for i := 0; i < scan; i++ {
+		if i%64 == 0 && ctx.Err() != nil {
+			truncated = true
+			break
+		}
+		if strings.Contains(table.usernameIndex[i].UsernameLower, substr) {
+			matches = append(matches, table.usernameIndex[i].ID)
+		}
+	}
+
+	total := len(matches)
+	totalPages := calcTotalPages(total, limit)
+	page = clampPage(page, totalPages)
+	offset := (page - 1) * limit
+	if offset >= total {
+		return nil, total, page, totalPages, truncated
+	}
+	end := min(offset+limit, total)
+	snap := s.currentSnapshot()
+	results := make([]LeaderboardEntry, 0, end-offset)
+	for _, id := range matches[offset:end] {
+		results = append(results, s.snapshotEntry(table, snap, id))
+	}
+	return results, total, page, totalPages, truncated
+}
+
+// SearchFunc streams prefix matches in username order, visiting at most
+// budget index entries. It stops early when fn returns false or ctx ends,
+// and reports how many matches were emitted and whether the budget cut the
+// scan short.
+func (s *Store) SearchFunc(ctx context.Context, prefix string, budget int, fn func(LeaderboardEntry) bool) (int, bool, error) {
+	prefix = normalizeUsername(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return 0, false, nil
+	}
+	table := s.loadTable()
+	start, end := table.prefixRange(prefix)
+	truncated := budget > 0 && end-start > budget
+	if truncated {
+		end = start + budget
+	}
+
+	snap := s.currentSnapshot()
+	emitted := 0
+	for i := start; i < end; i++ {
+		if i%64 == 0 {
+			if err := ctx.Err(); err != nil {
+				return emitted, truncated, err
+			}
+		}
+		emitted++
+		if !fn(s.snapshotEntry(table, snap, table.usernameIndex[i].ID)) {
+			break
+		}
+	}
+	return emitted, truncated, nil
+}
+
+// SearchContainsFunc streams the matches SearchContains would page
+// through, in username order and under the same scan budget. It stops early
+// when fn returns false or ctx ends, and reports how many matches were
+// emitted and whether the budget cut the scan short.
+func (s *Store) SearchContainsFunc(ctx context.Context, substr string, fn func(LeaderboardEntry) bool) (int, bool, error) {
+	substr = normalizeUsername(strings.TrimSpace(substr))
+	if utf8.RuneCountInString(substr) < minContainsLength {
+		return 0, false, nil
+	}
+	table := s.loadTable()
+	scan := len(table.usernameIndex)
+	truncated := scan > searchScanBudget
+	if truncated {
+		scan = searchScanBudget
+	}
+
+	snap := s.currentSnapshot()
+	emitted := 0
+	for i := 0; i < scan; i++ {
+		if i%64 == 0 {
+			if err := ctx.Err(); err != nil {
+				return emitted, truncated, err
+			}
+		}
+		item := table.usernameIndex[i]
+		if !strings.Contains(item.UsernameLower, substr) {
+			continue
+		}
+		emitted++
+		if !fn(s.snapshotEntry(table, snap, item.ID)) {
+			break
+		}
+	}
+	return emitted, truncated, nil
+}
+
+// TopPrefixes counts usernames by their first length runes in one pass over
+// the sorted index, where equal prefixes are always adjacent. Names shorter
+// than length are skipped.
+func (s *Store) TopPrefixes(length int, top int) []PrefixCount {
+	var counts []PrefixCount
+	for _, item := range s.loadTable().usernameIndex {
+		prefix, ok := runePrefix(item.UsernameLower, length)
+		if !ok {
+			continue
+		}
+		if n := len(counts); n > 0 && counts[n-1].Prefix == prefix {
+			counts[n-1].Count++
+			continue
+		}
+		counts = append(counts, PrefixCount{Prefix: prefix, Count: 1})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count == counts[j].Count {
+			return counts[i].Prefix < counts[j].Prefix
+		}
+		return counts[i].Count > counts[j].Count
+	})
+	if len(counts) > top {
+		counts = counts[:top]
+	}
+	return counts
+}
+
+func runePrefix(value string, length int) (string, bool) {
+	seen := 0
+	for i := range value {
+		if seen == length {
+			return value[:i], true
+		}
+		seen++
+	}
+	return value, seen == length
+}
+
+// SearchFuzzy suggests usernames whose start is within a small edit
+// distance of query (1 for queries under 5 runes, 2 otherwise), skipping
+// exact prefix matches. At most budget index entries are scanned. Results
+// are ordered by distance, then rank.
+func (s *Store) SearchFuzzy(query string, limit int, budget int) []LeaderboardEntry {
+	query = normalizeUsername(strings.TrimSpace(query))
+	if query == "" || limit <= 0 {
+		return []LeaderboardEntry{}
+	}
+	target := []rune(query)
+	maxDistance := 1
+	if len(target) >= 5 {
+		maxDistance = 2
+	}
+
+	type candidate struct {
+		entry    LeaderboardEntry
+		distance int
+	}
+	var candidates []candidate
+	table := s.loadTable()
+	snap := s.currentSnapshot()
+	scan := len(table.usernameIndex)
+	if budget > 0 && scan > budget {
+		scan = budget
+	}
+	for i := 0; i < scan; i++ {
+		item := table.usernameIndex[i]
+		distance := prefixEditDistance(target, item.UsernameLower, maxDistance)
+		if distance == 0 || distance > maxDistance {
+			continue
+		}
+		candidates = append(candidates, candidate{entry: s.snapshotEntry(table, snap, item.ID), distance: distance})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		if candidates[i].entry.Rank != candidates[j].entry.Rank {
+			return candidates[i].entry.Rank < candidates[j].entry.Rank
+		}
+		return candidates[i].entry.Username < candidates[j].entry.Username
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	results := make([]LeaderboardEntry, 0, len(candidates))
+	for _, item := range candidates {
+		results = append(results, item.entry)
+	}
+	return results
+}
+
+// prefixEditDistance is the Levenshtein distance between target and the
+// closest prefix of value. It gives up early, returning maxDistance+1, once
+// every alignment is already too far.
+func prefixEditDistance(target []rune, value string, maxDistance int) int {
+	prev := make([]int, len(target)+1)
+	curr := make([]int, len(target)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	best := prev[len(target)]
+
+	for _, r := range value {
+		curr[0] = prev[0] + 1
+		rowMin := curr[0]
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if target[j-1] == r {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		best = min(best, curr[len(target)])
+		if rowMin > maxDistance {
+			break
+		}
+		prev, curr = curr, prev
+	}
+	return best
+}
+
+func (t *userTable) prefixRange(prefix string) (int, int) {
+	start := sort.Search(len(t.usernameIndex), func(i int) bool {
+		return t.usernameIndex[i].UsernameLower >= prefix
+	})
+	prefixHigh, bounded := prefixUpperBound(prefix)
+	if !bounded {
+		return start, len(t.usernameIndex)
+	}
+	end := sort.Search(len(t.usernameIndex), func(i int) bool {
+		return t.usernameIndex[i].UsernameLower >= prefixHigh
+	})
+	return start, end
+}
+
+// prefixUpperBound returns the smallest string greater than every string
+// that starts with prefix, by bumping its last rune. UTF-8 byte order matches
+// code point order, so this is exact for multibyte names. A last rune that
+// cannot be bumped is dropped and the carry moves left; when nothing is left
+// the range is unbounded.
+func prefixUpperBound(prefix string) (string, bool) {
+	for len(prefix) > 0 {
+		r, size := utf8.DecodeLastRuneInString(prefix)
+		head := prefix[:len(prefix)-size]
+		if r == utf8.RuneError && size == 1 {
+			if b := prefix[len(head)]; b < 0xff {
+				return head + string([]byte{b + 1}), true
+			}
+		} else if r < utf8.MaxRune {
+			next := r + 1
+			if next >= 0xD800 && next <= 0xDFFF {
+				next = 0xE000
+			}
+			return head + string(next), true
+		}
+		prefix = head
+	}
+	return "", false
+}
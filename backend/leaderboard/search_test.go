@@ -0,0 +1,212 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSearchFuncTruncation(t *testing.T) {
+	seeds := testSeeds(10)
+	s, err := NewStore(seeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	tests := []struct {
+		budget        int
+		wantEmitted   int
+		wantTruncated bool
+	}{
+		{0, 10, false},
+		{5, 5, true},
+		{9, 9, true},
+		{10, 10, false},
+		{11, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("budget %d", tt.budget), func(t *testing.T) {
+			emitted, truncated, err := s.SearchFunc(context.Background(), "user_", tt.budget, func(LeaderboardEntry) bool { return true })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if emitted != tt.wantEmitted || truncated != tt.wantTruncated {
+				t.Fatalf("got %d emitted, truncated %t; want %d, %t", emitted, truncated, tt.wantEmitted, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestPrefixUpperBound(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"a", "b", true},
+		{"jos", "jot", true},
+		{"josé", "josê", true},
+		{"😀", "😁", true},
+		{"a\U0010FFFF", "b", true},
+		{"\uD7FF", "\uE000", true},
+		{"\U0010FFFF", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := prefixUpperBound(tt.prefix)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("prefixUpperBound(%q) = %q, %t; want %q, %t", tt.prefix, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSearchPageUnicodePrefixes(t *testing.T) {
+	s, err := NewStore([]SeedUser{
+		{Username: "José", Rating: 2000},
+		{Username: "josé_2", Rating: 1900},
+		{Username: "Josh", Rating: 1800},
+		{Username: "Jot", Rating: 1700},
+		{Username: "😀gamer", Rating: 1600},
+		{Username: "😀😀", Rating: 1500},
+		{Username: "😁fan", Rating: 1400},
+		{Username: "zoë", Rating: 1300},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"jos", []string{"José", "josé_2", "Josh"}},
+		{"José", []string{"José", "josé_2"}},
+		{"jose_", []string{"josé_2"}},
+		{"😀", []string{"😀gamer", "😀😀"}},
+		{"😀😀", []string{"😀😀"}},
+		{"😁", []string{"😁fan"}},
+		{"zoe", []string{"zoë"}},
+		{"zoë", []string{"zoë"}},
+	}
+	for _, tt := range tests {
+		results, total, _, _ := s.SearchPage(tt.prefix, 1, 20)
+		var got []string
+		for _, entry := range results {
+			got = append(got, entry.Username)
+		}
+		slices.Sort(got)
+		want := slices.Clone(tt.want)
+		slices.Sort(want)
+		if !slices.Equal(got, want) || total != len(want) {
+			t.Errorf("SearchPage(%q) = %v (total %d), want %v", tt.prefix, got, total, want)
+		}
+	}
+}
+
+func TestSearchPost(t *testing.T) {
+	seeds := []SeedUser{
+		{Username: "john doe", Rating: 3000},
+		{Username: "john doe jr", Rating: 2900},
+		{Username: "johnny", Rating: 2800},
+		{Username: "a&b=c?d", Rating: 2700},
+		{Username: "50% off#1", Rating: 2600},
+		{Username: "x/y+z", Rating: 2500},
+	}
+	a := newTestApp(t, seeds, nil)
+	usernames := func(rec *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var body SearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%d %s: %v", rec.Code, rec.Body, err)
+		}
+		names := make([]string, len(body.Results))
+		for i, entry := range body.Results {
+			names[i] = entry.Username
+		}
+		return names
+	}
+
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"query": "john doe"}`, []string{"john doe", "john doe jr"}},
+		{`{"query": "a&b=c?"}`, []string{"a&b=c?d"}},
+		{`{"query": "50% off#"}`, []string{"50% off#1"}},
+		{`{"query": "x/y+"}`, []string{"x/y+z"}},
+		{`{"query": "off#1", "mode": "contains"}`, []string{"50% off#1"}},
+		{`{"query": "john", "page": 2, "limit": 2}`, []string{"johnny"}},
+	}
+	for _, tt := range tests {
+		rec := serve(a, http.MethodPost, "/search", tt.body, http.Header{"Content-Type": {"application/json"}})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", tt.body, rec.Code, rec.Body)
+		}
+		if got := usernames(rec); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.body, got, tt.want)
+		}
+		// The same search as GET must agree once the query is escaped.
+		var req SearchRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Fatal(err)
+		}
+		query := url.Values{"q": {req.Query}, "mode": {req.Mode}}
+		if req.Page > 0 {
+			query.Set("page", strconv.Itoa(req.Page))
+			query.Set("limit", strconv.Itoa(req.Limit))
+		}
+		if got := usernames(serve(a, http.MethodGet, "/search?"+query.Encode(), "", nil)); !slices.Equal(got, tt.want) {
+			t.Errorf("GET %s: got %v, want %v", query.Encode(), got, tt.want)
+		}
+	}
+
+	for _, body := range []string{
+		`{"query": "john"`,
+		`["john"]`,
+		`{"query": "john", "page": -1}`,
+		`{"query": "john", "limit": -5}`,
+		`{"query": "` + strings.Repeat("j", maxSearchBodyBytes) + `"}`,
+	} {
+		rec := serve(a, http.MethodPost, "/search", body, nil)
+		var errBody map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &errBody); err != nil || rec.Code != http.StatusBadRequest || errBody["error"] == "" {
+			t.Errorf("body %.40q: got %d %s, want a 400 JSON error", body, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestSearchContext(t *testing.T) {
+	a := newTestApp(t, testSeeds(10), nil)
+	var body SearchResponse
+	if err := json.Unmarshal(serve(a, http.MethodGet, "/search?q=user_00&context=1", "", nil).Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Results) != 10 {
+		t.Fatalf("%d results, want 10", len(body.Results))
+	}
+	for i, entry := range body.Results {
+		if (entry.Above == nil) != (i == 0) || (entry.Below == nil) != (i == 9) {
+			t.Fatalf("%s: above %v, below %v", entry.Username, entry.Above, entry.Below)
+		}
+		if entry.Above != nil && entry.Above.Rank != entry.Rank-1 {
+			t.Errorf("%s#%d: above is rank %d", entry.Username, entry.Rank, entry.Above.Rank)
+		}
+		if entry.Below != nil && entry.Below.Rank != entry.Rank+1 {
+			t.Errorf("%s#%d: below is rank %d", entry.Username, entry.Rank, entry.Below.Rank)
+		}
+	}
+
+	if raw := serve(a, http.MethodGet, "/search?q=user_00", "", nil).Body.String(); strings.Contains(raw, `"above"`) || strings.Contains(raw, `"below"`) {
+		t.Fatalf("neighbors sent without context=1: %s", raw)
+	}
+	rec := serve(a, http.MethodGet, fmt.Sprintf("/search?q=user&context=1&limit=%d", maxContextLimit+1), "", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("context over the page cap: got %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package leaderboard
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadSeedFile reads seed users from a CSV file of username,rating[,group]
+// rows.
+func loadSeedFile(path string) ([]SeedUser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	seeds, err := parseSeedCSV(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return seeds, nil
+}
+
+// parseSeedCSV parses username,rating rows with an optional third group
+// column. Blank lines are skipped, fields are trimmed, and an optional
+// leading "username,rating" or "username,rating,group" header is ignored.
+// Ratings are clamped by the store, and a missing or blank group puts the
+// user in the default group. Errors name the line.
+func parseSeedCSV(r io.Reader) ([]SeedUser, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var seeds []SeedUser
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected username,rating", line)
+		}
+
+		username := strings.TrimSpace(record[0])
+		ratingField := strings.TrimSpace(record[1])
+		if len(seeds) == 0 && strings.EqualFold(username, "username") && strings.EqualFold(ratingField, "rating") {
+			continue
+		}
+		if username == "" {
+			return nil, fmt.Errorf("line %d: missing username", line)
+		}
+		rating, err := strconv.Atoi(ratingField)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rating %q", line, ratingField)
+		}
+		var group string
+		if len(record) > 2 {
+			group = strings.TrimSpace(record[2])
+		}
+		seeds = append(seeds, SeedUser{Username: username, Rating: rating, Group: group})
+	}
+	return seeds, nil
+}
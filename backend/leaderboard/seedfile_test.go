@@ -0,0 +1,44 @@
+package leaderboard
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSeedCSVGroupColumn(t *testing.T) {
+	csv := strings.Join([]string{
+		"username,rating,group",
+		"alice, 1500, red",
+		"bob,1400",
+		"",
+		"carol,1300,  ",
+		"dave,1200, blue ",
+	}, "\n")
+	seeds, err := parseSeedCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SeedUser{
+		{Username: "alice", Rating: 1500, Group: "red"},
+		{Username: "bob", Rating: 1400},
+		{Username: "carol", Rating: 1300},
+		{Username: "dave", Rating: 1200, Group: "blue"},
+	}
+	if !slices.Equal(seeds, want) {
+		t.Fatalf("seeds = %+v, want %+v", seeds, want)
+	}
+
+	store, err := NewStore(seeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.RefreshSnapshot()
+	groups := make(map[string]int)
+	for _, group := range store.GroupedLeaderboard(10, 0) {
+		groups[group.Group] = group.Members
+	}
+	if groups["red"] != 1 || groups["blue"] != 1 || groups[defaultGroup] != 2 {
+		t.Fatalf("group members = %v, want red 1, blue 1, default 2", groups)
+	}
+}
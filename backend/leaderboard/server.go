@@ -0,0 +1,969 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+type app struct {
+	store   *Store
+	handler http.Handler
+
+	port        string
+	stateFile   string
+	logger      *slog.Logger
+	maxPageSize int
+	maxTopN     int
+
+	requestTimeout time.Duration
+
+	corsOrigins    map[string]struct{}
+	limiter        *rateLimiter
+	trustForwarded bool
+
+	adminToken  string
+	maintenance atomic.Bool
+	retryAfter  int
+
+	// draining is set when graceful shutdown starts, failing /readyz so
+	// load balancers stop routing here; drainDelay is how long to keep
+	// serving after that before the listener closes.
+	draining   atomic.Bool
+	drainDelay time.Duration
+
+	mux       *http.ServeMux
+	startedAt time.Time
+	requests  rateCounter
+	endpoints endpointCounter
+
+	consistencyCheck     bool
+	consistencyTolerance int
+
+	done       <-chan struct{}
+	stop       context.CancelFunc
+	background sync.WaitGroup
+}
+
+const shutdownTimeout = 10 * time.Second
+
+var (
+	appOnce     sync.Once
+	appInstance *app
+	appErr      error
+)
+
+func getApp() (*app, error) {
+	appOnce.Do(func() {
+		appInstance, appErr = buildApp()
+		if appErr != nil {
+			slog.Error("building app failed", "error", appErr)
+		}
+	})
+	return appInstance, appErr
+}
+
+// Handler serves the app built from the environment. If the seed users
+// cannot be loaded every request gets a 500.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	a, err := getApp()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "server failed to start")
+		return
+	}
+	a.handler.ServeHTTP(w, r)
+}
+
+func (a *app) goBackground(fn func()) {
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		fn()
+	}()
+}
+
+// shutdown stops the background loops and open streams, waits for the
+// loops to return, then saves the store to the state file if one is set.
+func (a *app) shutdown() {
+	a.stop()
+	a.background.Wait()
+	if a.stateFile == "" {
+		return
+	}
+	if err := saveStateFile(a.store, a.stateFile); err != nil {
+		a.logger.Error("saving state file failed", "path", a.stateFile, "error", err)
+		return
+	}
+	a.logger.Info("saved state file", "path", a.stateFile, "users", a.store.UserCount())
+}
+
+// readiness is "ok" once the first snapshot is served, "starting" before
+// that, and "draining" from the start of graceful shutdown.
+func (a *app) readiness() string {
+	switch {
+	case a.draining.Load():
+		return "draining"
+	case !a.store.Ready():
+		return "starting"
+	default:
+		return "ok"
+	}
+}
+
+func buildApp() (*app, error) {
+	return buildAppWithConfig(LoadConfigFromEnv())
+}
+
+// buildAppWithConfig builds the store and handlers from cfg and starts the
+// background loops. Unknown rank directions, ranking modes and tiers are
+// logged and ignored; StartServerWithConfig rejects them up front. Seed
+// users that cannot be loaded, repeat a username or, with StrictRatings,
+// fall outside the bounds are an error, and nothing is started.
+func buildAppWithConfig(cfg Config) (*app, error) {
+	logger, err := newLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		logger, _ = newLogger(os.Stderr, DefaultConfig().LogFormat, DefaultConfig().LogLevel)
+		logger.Warn("ignoring LOG_LEVEL/LOG_FORMAT", "error", err)
+	}
+
+	if cfg.MinRating > cfg.MaxRating {
+		logger.Warn("ignoring MIN_RATING/MAX_RATING", "min_rating", cfg.MinRating, "max_rating", cfg.MaxRating)
+		cfg.MinRating, cfg.MaxRating = defaultMinRating, defaultMaxRating
+	}
+	var store *Store
+	if cfg.Seeds == nil && cfg.StateFile != "" {
+		loaded, err := loadStateFile(cfg.StateFile, cfg.MinRating, cfg.MaxRating)
+		if err != nil {
+			logger.Warn("ignoring STATE_FILE, seeding instead", "error", err)
+		}
+		store = loaded
+	}
+	if store == nil {
+		seeds := cfg.Seeds
+		if seeds == nil && cfg.SeedFile != "" {
+			loaded, err := loadSeedFile(cfg.SeedFile)
+			if err != nil {
+				return nil, fmt.Errorf("loading seed file: %w", err)
+			}
+			seeds = loaded
+		} else if seeds == nil {
+			seeds = generateUsers(cfg.SeedUsers, cfg.SeedSpecials, cfg.MinRating, cfg.MaxRating, cfg.Seed, cfg.NameWords, cfg.NounWords)
+		}
+		if cfg.StrictRatings {
+			if err := checkSeedRatings(seeds, cfg.MinRating, cfg.MaxRating); err != nil {
+				return nil, fmt.Errorf("seed users: %w", err)
+			}
+		}
+		built, err := NewStoreWithBounds(seeds, cfg.MinRating, cfg.MaxRating)
+		if err != nil {
+			return nil, fmt.Errorf("seed users: %w", err)
+		}
+		store = built
+	}
+	store.tracer = newTracerFromEnv(logger)
+	store.SetStrictRatings(cfg.StrictRatings)
+	store.SetSnapshotHistory(cfg.SnapshotHistory)
+	if err := store.SetRankDirection(cfg.RankDirection); err != nil {
+		logger.Warn("ignoring RANK_DIRECTION", "error", err)
+	}
+	if cfg.Tiers != "" {
+		tiers, err := parseTiers(cfg.Tiers, cfg.MinRating, cfg.MaxRating)
+		if err != nil {
+			logger.Warn("ignoring TIERS", "error", err)
+		} else {
+			store.tiers = tiers
+		}
+	}
+	if err := store.SetRankingMode(cfg.RankingMode); err != nil {
+		logger.Warn("ignoring RANKING_MODE", "error", err)
+	}
+	if tieBreak, err := store.namedTieBreak(cfg.TieBreak); err != nil {
+		logger.Warn("ignoring TIE_BREAK", "error", err)
+	} else {
+		store.SetTieBreak(tieBreak)
+	}
+	store.RefreshSnapshot()
+
+	maxPageSize := cfg.MaxPageSize
+	if maxPageSize <= 0 {
+		maxPageSize = DefaultConfig().MaxPageSize
+	}
+	maxTopN := cfg.MaxTopN
+	if maxTopN <= 0 {
+		maxTopN = DefaultConfig().MaxTopN
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	a := &app{
+		store:       store,
+		done:        ctx.Done(),
+		stop:        stop,
+		port:        cfg.Port,
+		stateFile:   cfg.StateFile,
+		logger:      logger,
+		maxPageSize: maxPageSize,
+		maxTopN:     maxTopN,
+		adminToken:  cfg.AdminToken,
+		retryAfter:  cfg.MaintenanceRetryAfter,
+		startedAt:   time.Now(),
+
+		consistencyCheck:     cfg.ConsistencyCheck,
+		consistencyTolerance: cfg.ConsistencyTolerance,
+
+		trustForwarded: cfg.TrustForwardedFor,
+		requestTimeout: time.Duration(cfg.RequestTimeoutMs) * time.Millisecond,
+		drainDelay:     time.Duration(cfg.DrainDelayMs) * time.Millisecond,
+	}
+	a.maintenance.Store(cfg.Maintenance)
+	if len(cfg.CORSOrigins) > 0 {
+		a.corsOrigins = make(map[string]struct{}, len(cfg.CORSOrigins))
+		for _, origin := range cfg.CORSOrigins {
+			a.corsOrigins[origin] = struct{}{}
+		}
+	}
+	if cfg.RateLimit > 0 {
+		a.limiter = newRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+
+	a.goBackground(func() { store.tracer.Run(ctx) })
+	a.goBackground(func() { store.StartRandomUpdates(ctx, cfg.UpdatesPerTick, cfg.TickMs, cfg.UpdateDeltaMax, cfg.Seed) })
+	a.goBackground(func() { store.StartSnapshotLoop(ctx, cfg.SnapshotMs) })
+	a.goBackground(func() { store.RunWebhooks(ctx, logger) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		writeResponse(w, r, http.StatusOK, map[string]string{"status": "backend running"})
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		response := HealthResponse{
+			Status:         "ok",
+			Users:          store.UserCount(),
+			SnapshotAgeMs:  store.SnapshotAge().Milliseconds(),
+			UpdatesEnabled: !store.UpdatesPaused(),
+		}
+		if status := a.readiness(); status != "ok" {
+			response.Status = status
+			writeResponse(w, r, http.StatusServiceUnavailable, response)
+			return
+		}
+		writeResponse(w, r, http.StatusOK, response)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		status := a.readiness()
+		code := http.StatusOK
+		if status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		writeResponse(w, r, code, map[string]string{"status": status})
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		status := "ok"
+		if a.maintenance.Load() {
+			status = "maintenance"
+		}
+		writeResponse(w, r, http.StatusOK, StatusResponse{
+			Status:          status,
+			Maintenance:     a.maintenance.Load(),
+			SnapshotsPaused: store.SnapshotsPaused(),
+			TotalUsers:      store.UserCount(),
+			SnapshotVersion: store.SnapshotVersion(),
+			UpdatedAt:       store.LastUpdate().UTC().Format(time.RFC3339),
+		})
+	})
+	mux.HandleFunc("/metrics/summary", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		writeResponse(w, r, http.StatusOK, MetricsSummary{
+			StartedAt:           a.startedAt.UTC().Format(time.RFC3339),
+			UptimeSeconds:       now.Sub(a.startedAt).Seconds(),
+			RatingUpdatesTotal:  store.UpdatesApplied(),
+			SnapshotsBuiltTotal: store.SnapshotsBuilt(),
+			RequestsTotal:       a.requests.Total(),
+			RequestsPerSecond:   a.requests.Rate(now, a.startedAt),
+			Timings:             store.Timings(),
+		})
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, http.StatusOK, NewBuildInfo())
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheus(w, a)
+	})
+	mux.HandleFunc("/debug/consistency", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		page := getQueryInt(r, "page", 1)
+		if page <= 0 {
+			page = 1
+		}
+		limit := getQueryInt(r, "limit", 200)
+		if limit <= 0 || limit > 1000 {
+			limit = 200
+		}
+		tolerance := getQueryInt(r, "tolerance", a.consistencyTolerance)
+		if tolerance < 0 {
+			tolerance = 0
+		}
+		writeResponse(w, r, http.StatusOK, store.CheckConsistency((page-1)*limit, limit, tolerance))
+	}))
+	mux.HandleFunc("/admin/snapshots", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var body toggleRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil || body.Enabled == nil {
+				writeError(w, r, http.StatusBadRequest, `body must be {"enabled": true|false}`)
+				return
+			}
+			store.SetSnapshotsPaused(!*body.Enabled)
+			a.logger.Info("snapshot refresh toggled", "enabled", *body.Enabled)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeResponse(w, r, http.StatusOK, map[string]any{
+			"enabled":          !store.SnapshotsPaused(),
+			"snapshot_version": store.SnapshotVersion(),
+		})
+	}))
+	mux.HandleFunc("/admin/maintenance", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var body toggleRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil || body.Enabled == nil {
+				writeError(w, r, http.StatusBadRequest, `body must be {"enabled": true|false}`)
+				return
+			}
+			a.maintenance.Store(*body.Enabled)
+			a.logger.Info("maintenance mode toggled", "enabled", *body.Enabled)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeResponse(w, r, http.StatusOK, map[string]bool{"enabled": a.maintenance.Load()})
+	}))
+	mux.HandleFunc("/admin/updates", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var body toggleRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil || body.Enabled == nil {
+				writeError(w, r, http.StatusBadRequest, `body must be {"enabled": true|false}`)
+				return
+			}
+			store.SetUpdatesPaused(!*body.Enabled)
+			a.logger.Info("random updates toggled", "enabled", *body.Enabled)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeResponse(w, r, http.StatusOK, map[string]any{
+			"enabled":         !store.UpdatesPaused(),
+			"updates_applied": store.UpdatesApplied(),
+		})
+	}))
+	mux.HandleFunc("/admin/watches", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			watches, dropped := store.Watches()
+			writeResponse(w, r, http.StatusOK, WatchesResponse{Watches: watches, Dropped: dropped})
+		case http.MethodPost:
+			var body WatchRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil || body.Threshold == nil {
+				writeError(w, r, http.StatusBadRequest, `body must be {"threshold": 4000, "url": "https://..."}`)
+				return
+			}
+			watch, err := store.AddWatch(*body.Threshold, body.URL)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			a.logger.Info("watch added", "watch_id", watch.ID, "threshold", watch.Threshold)
+			writeResponse(w, r, http.StatusCreated, watch)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}))
+	mux.HandleFunc("DELETE /admin/watches/{id}", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || !store.RemoveWatch(id) {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("watch %q not found", r.PathValue("id")))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/admin/refresh", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		store.RefreshSnapshot()
+		snap := store.currentSnapshot()
+		writeResponse(w, r, http.StatusOK, map[string]any{
+			"snapshot_version": snap.version,
+			"total_users":      len(snap.ids),
+		})
+	}))
+	mux.HandleFunc("/leaderboard/stream", func(w http.ResponseWriter, r *http.Request) {
+		n := clampLimit(getQueryInt(r, "n", 20), 20, a.maxPageSize)
+		streamLeaderboard(w, r, store, n, a.done)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		n := clampLimit(getQueryInt(r, "n", 20), 20, a.maxPageSize)
+		a.serveLeaderboardWS(w, r, n)
+	})
+	mux.HandleFunc("/leaderboard.sql", func(w http.ResponseWriter, r *http.Request) {
+		table := r.URL.Query().Get("table")
+		if table == "" {
+			table = "leaderboard"
+		}
+		if !validSQLIdentifier(table) {
+			writeError(w, r, http.StatusBadRequest, "table must be a letter or underscore followed by up to 62 letters, digits or underscores")
+			return
+		}
+		writeSQLExport(w, store, table)
+	})
+	mux.HandleFunc("GET /export.ndjson", func(w http.ResponseWriter, r *http.Request) {
+		writeNDJSONExport(w, r, store, strings.ToLower(r.URL.Query().Get("order")) == "asc")
+	})
+	mux.HandleFunc("/leaderboard/around", func(w http.ResponseWriter, r *http.Request) {
+		username := r.URL.Query().Get("username")
+		radius := getQueryInt(r, "radius", 5)
+		if radius < 0 {
+			radius = 5
+		}
+		if radius > maxAroundRadius {
+			radius = maxAroundRadius
+		}
+		entries, center, ok := store.Around(username, radius)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+			return
+		}
+		writeResponse(w, r, http.StatusOK, AroundResponse{
+			Username: entries[center].Username,
+			Radius:   radius,
+			Center:   center,
+			Entries:  entries,
+		})
+	})
+	mux.HandleFunc("/leaderboard/grouped", func(w http.ResponseWriter, r *http.Request) {
+		top := clampLimit(getQueryInt(r, "top", 10), 10, maxGroupedTop)
+		response := GroupedLeaderboardResponse{
+			UpdatedAt: store.LastUpdate().UTC().Format(time.RFC3339),
+			Top:       top,
+			Groups:    store.GroupedLeaderboard(top, maxGroupedEntries),
+		}
+		writeResponse(w, r, http.StatusOK, response)
+	})
+	mux.HandleFunc("/top/changes", func(w http.ResponseWriter, r *http.Request) {
+		n := clampLimit(getQueryInt(r, "n", 100), 100, maxTopChangesN)
+		since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		changes, version, baseline := store.TopChanges(n, since)
+		response := TopChangesResponse{
+			Version:  version,
+			Since:    since,
+			N:        n,
+			Baseline: baseline,
+			Changes:  changes,
+		}
+		writeResponse(w, r, http.StatusOK, response)
+	})
+	mux.HandleFunc("/leaderboard/delta", func(w http.ResponseWriter, r *http.Request) {
+		n := clampLimit(getQueryInt(r, "n", 100), 100, maxTopChangesN)
+		since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		changed, removed, version, fullReload := store.LeaderboardDelta(n, since)
+		writeResponse(w, r, http.StatusOK, LeaderboardDeltaResponse{
+			Version:    version,
+			Since:      since,
+			N:          n,
+			FullReload: fullReload,
+			Changed:    changed,
+			Removed:    removed,
+		})
+	})
+	mux.HandleFunc("/entries/by-rank", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var body EntriesByRankRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			writeError(w, r, http.StatusBadRequest, `body must be {"ranks": [1, 5, 10]}`)
+			return
+		}
+		if len(body.Ranks) == 0 || len(body.Ranks) > maxRankBatch {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("ranks must contain 1-%d values", maxRankBatch))
+			return
+		}
+		entries, version, err := store.EntriesAtRanks(body.Ranks)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeResponse(w, r, http.StatusOK, EntriesByRankResponse{Version: version, Entries: entries})
+	})
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var body AddUserRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			writeError(w, r, http.StatusBadRequest, `body must be {"username": "name", "rating": 1200, "group": "optional"}`)
+			return
+		}
+		rank, err := store.AddUserWithGroup(body.Username, body.Rating, body.Group)
+		if errors.Is(err, ErrUsernameTaken) {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeResponse(w, r, http.StatusCreated, LeaderboardEntry{
+			Rank:     rank,
+			Username: strings.TrimSpace(body.Username),
+			Rating:   store.clampRating(body.Rating),
+		})
+	})
+	mux.HandleFunc("DELETE /users/{username}", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		if !store.RemoveUser(username) {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("PUT /users/{username}/rating", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		username := r.PathValue("username")
+		var body SetRatingRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil || body.Rating == nil {
+			writeError(w, r, http.StatusBadRequest, `body must be {"rating": 1200}`)
+			return
+		}
+		dryRun := getQueryBool(r, "dry_run", false)
+		var entry LeaderboardEntry
+		var err error
+		if dryRun {
+			entry, err = store.PreviewRating(username, *body.Rating)
+		} else {
+			entry, err = store.SetRatingByUsername(username, *body.Rating)
+		}
+		var notFound *UsersNotFoundError
+		if errors.As(err, &notFound) {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("user %q not found", username))
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeResponse(w, r, http.StatusOK, SetRatingResponse{LeaderboardEntry: entry, DryRun: dryRun})
+	}))
+	mux.HandleFunc("POST /users/ratings", a.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		var batch []RatingChange
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10)).Decode(&batch); err != nil {
+			writeError(w, r, http.StatusBadRequest, `body must be [{"username": "name", "rating": 1200}]`)
+			return
+		}
+		if len(batch) == 0 || len(batch) > maxRatingBatch {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("batch must contain 1-%d changes", maxRatingBatch))
+			return
+		}
+		dryRun := getQueryBool(r, "dry_run", false)
+		var results []SetResult
+		if dryRun {
+			results = store.PreviewRatings(batch)
+		} else {
+			results = store.SetRatings(batch)
+		}
+		applied := 0
+		for _, result := range results {
+			if result.Applied {
+				applied++
+			}
+		}
+		writeResponse(w, r, http.StatusOK, SetRatingsResponse{Applied: applied, DryRun: dryRun, Results: results})
+	}))
+	mux.HandleFunc("/validate-username", func(w http.ResponseWriter, r *http.Request) {
+		username := strings.TrimSpace(r.URL.Query().Get("username"))
+		result := UsernameValidation{Username: username, Valid: true}
+		if err := validateUsername(username); err != nil {
+			result.Valid = false
+			result.Reason = err.Error()
+		}
+		_, taken := store.findUserID(username)
+		result.Available = username != "" && !taken
+		if result.Valid && taken {
+			result.Reason = ErrUsernameTaken.Error()
+		}
+		writeResponse(w, r, http.StatusOK, result)
+	})
+	mux.HandleFunc("/entry", func(w http.ResponseWriter, r *http.Request) {
+		position, err := strconv.Atoi(r.URL.Query().Get("position"))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "position must be an integer")
+			return
+		}
+		snap := store.currentSnapshot()
+		if len(snap.ids) == 0 {
+			writeError(w, r, http.StatusNotFound, "leaderboard is empty")
+			return
+		}
+		entry, ok := store.entryAt(snap, position)
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("position must be between 0 and %d", len(snap.ids)-1))
+			return
+		}
+		writeResponse(w, r, http.StatusOK, EntryResponse{
+			Version:  snap.version,
+			Position: position,
+			Total:    len(snap.ids),
+			Entry:    entry,
+		})
+	})
+	mux.HandleFunc("/prefixes", func(w http.ResponseWriter, r *http.Request) {
+		length := clampLimit(getQueryInt(r, "len", 3), 3, maxPrefixLength)
+		top := clampLimit(getQueryInt(r, "top", 20), 20, maxPrefixTop)
+		writeResponse(w, r, http.StatusOK, PrefixesResponse{
+			Length:   length,
+			Top:      top,
+			Prefixes: store.TopPrefixes(length, top),
+		})
+	})
+	mux.HandleFunc("/snapshot.bin", func(w http.ResponseWriter, r *http.Request) {
+		snap := store.currentSnapshot()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Snapshot-Version", strconv.FormatUint(snap.version, 10))
+		_ = store.writeSnapshotBinary(w, snap, 0)
+	})
+	mux.HandleFunc("/snapshot-delta.bin", func(w http.ResponseWriter, r *http.Request) {
+		since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "since must be a snapshot version")
+			return
+		}
+		snap := store.currentSnapshot()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Snapshot-Version", strconv.FormatUint(snap.version, 10))
+		_ = store.writeSnapshotBinary(w, snap, since)
+	})
+	mux.HandleFunc("/search/combined", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		if query == "" {
+			query = r.URL.Query().Get("q")
+		}
+		limit := clampLimit(getQueryInt(r, "limit", combinedLimit), combinedLimit, maxCombinedLimit)
+
+		response := CombinedSearchResponse{
+			Query:  query,
+			Exact:  []LeaderboardEntry{},
+			Prefix: []LeaderboardEntry{},
+		}
+		table := store.loadTable()
+		if id, ok := table.findID(query); ok {
+			response.Exact = append(response.Exact, store.snapshotEntry(table, store.currentSnapshot(), id))
+		}
+		if results, _, _, _ := store.SearchPage(query, 1, limit); results != nil {
+			response.Prefix = results
+		}
+		response.Fuzzy = store.SearchFuzzy(query, limit, searchScanBudget)
+		writeResponse(w, r, http.StatusOK, response)
+	})
+	a.registerBoardRoutes(mux, store)
+
+	a.mux = mux
+	a.handler = a.withCORS(a.logRequests(withGzip(a.withRecovery(stripAPIPrefix(a.limitRate(a.withTracing(store.tracer, a.countRequests(a.withTimeout(a.withMaintenance(mux))))))))))
+
+	return a, nil
+}
+
+// decodeSearchRequest reads a POST /search body. Page and limit default as
+// on GET; a negative value, or with ?strict=1 a limit above maxLimit, is an
+// error.
+func decodeSearchRequest(w http.ResponseWriter, r *http.Request, maxLimit int) (SearchRequest, error) {
+	var req SearchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSearchBodyBytes)).Decode(&req); err != nil {
+		return SearchRequest{}, fmt.Errorf(`body must be {"query": "...", "page": 1, "limit": 20, "mode": "prefix"}, at most %d bytes`, maxSearchBodyBytes)
+	}
+	switch {
+	case req.Page < 0:
+		return SearchRequest{}, fmt.Errorf("page must be at least 1, got %d", req.Page)
+	case req.Limit < 0:
+		return SearchRequest{}, fmt.Errorf("limit must be positive, got %d", req.Limit)
+	case req.Limit > maxLimit && getQueryBool(r, "strict", false):
+		return SearchRequest{}, fmt.Errorf("limit must be at most %d, got %d", maxLimit, req.Limit)
+	}
+	req.Page = max(req.Page, 1)
+	req.Limit = clampLimit(req.Limit, 20, maxLimit)
+	return req, nil
+}
+
+// serveSearch answers a /search request, however its parameters arrived.
+// Field selection, percentiles and streaming still come from the query
+// string.
+func (a *app) serveSearch(w http.ResponseWriter, r *http.Request, board Leaderboard, req SearchRequest) {
+	query, page, limit := req.Query, req.Page, req.Limit
+	mode := req.Mode
+	if mode == "" {
+		mode = "prefix"
+	}
+	switch mode {
+	case "prefix":
+	case "contains":
+		if utf8.RuneCountInString(strings.TrimSpace(query)) < minContainsLength {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("contains search needs at least %d characters", minContainsLength))
+			return
+		}
+	default:
+		writeError(w, r, http.StatusBadRequest, "mode must be prefix or contains")
+		return
+	}
+	if wantsSearchStream(r) {
+		streamSearch(w, r, board, query, mode)
+		return
+	}
+	fields, err := parseEntryFields(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	withContext := getQueryBool(r, "context", false)
+	if withContext && limit > maxContextLimit {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("context needs limit of at most %d", maxContextLimit))
+		return
+	}
+	var (
+		results                    []LeaderboardEntry
+		total, pageOut, totalPages int
+		truncated                  bool
+	)
+	switch mode {
+	case "prefix":
+		pooled := getEntries()
+		defer putEntries(pooled)
+		results, total, pageOut, totalPages = board.AppendSearchPage(*pooled, query, page, limit)
+		*pooled = results
+	case "contains":
+		results, total, pageOut, totalPages, truncated = board.SearchContains(r.Context(), query, page, limit)
+	}
+	if getQueryBool(r, "include_percentile", false) || fields&fieldPercentile != 0 {
+		board.FillPercentiles(results)
+	}
+	if withContext {
+		board.FillNeighbors(results)
+	}
+	response := SearchResponse{
+		Query:      query,
+		Mode:       mode,
+		Count:      len(results),
+		Total:      total,
+		Page:       pageOut,
+		PageSize:   limit,
+		TotalPages: totalPages,
+		PageNav:    pageNav(pageOut, totalPages),
+		Truncated:  truncated,
+		Results:    results,
+	}
+	if fields != 0 {
+		writeResponse(w, r, http.StatusOK, projectedSearchResponse{response, projectedEntries{results, fields}})
+		return
+	}
+	writeResponse(w, r, http.StatusOK, response)
+}
+
+// wantsSearchStream reports whether a /search request asked for NDJSON
+// instead of one JSON page.
+func wantsSearchStream(r *http.Request) bool {
+	return getQueryBool(r, "stream", false) || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// streamSearch writes every match of a validated prefix or contains search
+// as NDJSON, then a final line with the count.
+func streamSearch(w http.ResponseWriter, r *http.Request, board Leaderboard, query string, mode string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	search := func(fn func(LeaderboardEntry) bool) (int, bool, error) {
+		return board.SearchFunc(r.Context(), query, searchScanBudget, fn)
+	}
+	if mode == "contains" {
+		search = func(fn func(LeaderboardEntry) bool) (int, bool, error) {
+			return board.SearchContainsFunc(r.Context(), query, fn)
+		}
+	}
+	count, truncated, err := search(func(entry LeaderboardEntry) bool {
+		if enc.Encode(entry) != nil {
+			return false
+		}
+		if flusher != nil && r.Context().Err() == nil {
+			flusher.Flush()
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	_ = enc.Encode(map[string]any{"done": true, "count": count, "truncated": truncated})
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// streamLeaderboard serves the top n entries as Server-Sent Events: one
+// frame on connect and one after every snapshot refresh, with a comment
+// heartbeat in between so idle proxies keep the connection open. The stream
+// ends when the client goes away or done closes on shutdown.
+func streamLeaderboard(w http.ResponseWriter, r *http.Request, store *Store, n int, done <-chan struct{}) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	updates, cancel := store.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func() error {
+		event := store.leaderboardEvent(n)
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.Version, payload); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	if send() != nil {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-done:
+			return
+		case <-updates:
+			if send() != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// StartServer serves the configuration from the environment until SIGINT
+// or SIGTERM and then shuts down gracefully.
+func StartServer() error {
+	return StartServerWithConfig(LoadConfigFromEnv())
+}
+
+// StartServerWithConfig validates cfg, then serves until SIGINT or SIGTERM.
+func StartServerWithConfig(cfg Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return StartServerContext(ctx, cfg)
+}
+
+// StartServerContext validates cfg and serves until ctx is done. It then
+// stops accepting connections, gives in-flight requests up to
+// shutdownTimeout to finish, and stops the background update and snapshot
+// loops before returning.
+func StartServerContext(ctx context.Context, cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	app, err := buildAppWithConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              ":" + app.port,
+		Handler:           app.handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	// Open SSE streams only end when the client leaves, so release them as
+	// soon as shutdown starts instead of waiting out the timeout.
+	server.RegisterOnShutdown(app.stop)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	app.logger.Info("leaderboard server running", "port", app.port, "users", app.store.UserCount())
+
+	select {
+	case err := <-serveErr:
+		app.shutdown()
+		return err
+	case <-ctx.Done():
+	}
+
+	app.draining.Store(true)
+	if app.drainDelay > 0 {
+		app.logger.Info("shutting down: not ready, waiting for load balancers", "delay", app.drainDelay)
+		time.Sleep(app.drainDelay)
+	}
+	app.logger.Info("shutting down: draining HTTP connections")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdownErr := server.Shutdown(shutdownCtx)
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	if shutdownErr != nil {
+		app.logger.Warn("shutting down: HTTP server did not drain", "error", shutdownErr)
+	} else {
+		app.logger.Info("shutting down: HTTP server stopped")
+	}
+
+	app.shutdown()
+	app.logger.Info("shutting down: background loops stopped")
+	return shutdownErr
+}
@@ -0,0 +1,1078 @@
+package leaderboard
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+const testAdminToken = "test-admin-token"
+
+// testSeeds returns count users named user_000, user_001, ... with distinct
+// ratings, highest first.
+func testSeeds(count int) []SeedUser {
+	seeds := make([]SeedUser, count)
+	for i := range seeds {
+		seeds[i] = SeedUser{Username: fmt.Sprintf("user_%03d", i), Rating: 4000 - i*10}
+	}
+	return seeds
+}
+
+// newTestApp builds an app over seeds with the random updates off, so the
+// board only changes when a test changes it, and shuts it down when the
+// test ends. edit adjusts the config before the app is built.
+func newTestApp(t testing.TB, seeds []SeedUser, edit func(*Config)) *app {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Seeds = seeds
+	cfg.UpdatesPerTick = 0
+	cfg.RateLimit = 0
+	cfg.AdminToken = testAdminToken
+	cfg.LogLevel = "error"
+	if edit != nil {
+		edit(&cfg)
+	}
+	a, err := buildAppWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.shutdown)
+	return a
+}
+
+// serve sends one request through the full middleware chain.
+func serve(a *app, method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestAdminOnlyRoutesRequireToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		ok     int
+	}{
+		{"delete user", http.MethodDelete, "/users/user_001", http.StatusNoContent},
+		{"consistency check", http.MethodGet, "/debug/consistency", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, testSeeds(5), nil)
+			for _, header := range []http.Header{nil, bearer("wrong-token")} {
+				if rec := serve(a, tt.method, tt.target, "", header); rec.Code != http.StatusUnauthorized {
+					t.Fatalf("%s %s with %v: got %d, want %d", tt.method, tt.target, header, rec.Code, http.StatusUnauthorized)
+				}
+			}
+			if got := a.store.UserCount(); got != 5 {
+				t.Fatalf("unauthorized requests changed the board: %d users, want 5", got)
+			}
+			if rec := serve(a, tt.method, tt.target, "", bearer(testAdminToken)); rec.Code != tt.ok {
+				t.Fatalf("%s %s with the admin token: got %d, want %d: %s", tt.method, tt.target, rec.Code, tt.ok, rec.Body)
+			}
+		})
+	}
+}
+
+func TestDeleteUserWithoutAdminTokenConfigured(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), func(cfg *Config) { cfg.AdminToken = "" })
+	if rec := serve(a, http.MethodDelete, "/users/user_001", "", bearer("anything")); rec.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want %d while admin routes are disabled", rec.Code, http.StatusNotFound)
+	}
+	if got := a.store.UserCount(); got != 5 {
+		t.Fatalf("user was removed with admin routes disabled: %d users, want 5", got)
+	}
+}
+
+func TestAppShutdownLeavesNoGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	for i := 0; i < 3; i++ {
+		cfg := DefaultConfig()
+		cfg.Seeds = testSeeds(50)
+		cfg.TickMs = 5
+		cfg.SnapshotMs = 5
+		cfg.LogLevel = "error"
+		a, err := buildAppWithConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		a.shutdown()
+	}
+}
+
+func TestStartServerContextLeavesNoGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cfg := DefaultConfig()
+	cfg.Port = strconv.Itoa(port)
+	cfg.Seeds = testSeeds(50)
+	cfg.TickMs = 5
+	cfg.SnapshotMs = 5
+	cfg.LogLevel = "error"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- StartServerContext(ctx, cfg) }()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	defer client.CloseIdleConnections()
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err := client.Get(base + "/health")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server never became ready: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// An open stream only ends when the server releases it, so it checks
+	// that shutdown reaches the stream handlers too.
+	stream, err := client.Get(base + "/leaderboard/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	if _, err := bufio.NewReader(stream.Body).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("StartServerContext returned %v", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("server did not shut down")
+	}
+}
+
+func TestDenseRankingReadsTheSnapshot(t *testing.T) {
+	seeds := []SeedUser{
+		{Username: "ana", Rating: 3000},
+		{Username: "ben", Rating: 3000},
+		{Username: "cai", Rating: 2500},
+		{Username: "dev", Rating: 2000},
+		{Username: "eve", Rating: 1500},
+	}
+	a := newTestApp(t, seeds, nil)
+	// Live ratings change but no snapshot is published, so every rank on
+	// the page must still describe the snapshot's order.
+	for _, change := range []RatingChange{{"eve", 4000}, {"cai", 3000}} {
+		if _, err := a.store.SetRatingByUsername(change.Username, change.Rating); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"/leaderboard?ranking=dense", []string{"ana:1", "ben:1", "cai:2", "dev:3", "eve:4"}},
+		{"/leaderboard?ranking=dense&order=asc", []string{"eve:4", "dev:3", "cai:2", "ben:1", "ana:1"}},
+		{"/leaderboard?ranking=dense&page=2&limit=2", []string{"cai:2", "dev:3"}},
+		{"/leaderboard?ranking=dense&order=asc&page=2&limit=2", []string{"cai:2", "ben:1"}},
+	}
+	for _, tt := range tests {
+		rec := serve(a, http.MethodGet, tt.target, "", nil)
+		var body LeaderboardResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tt.target, err)
+		}
+		var got []string
+		for _, entry := range body.Entries {
+			got = append(got, fmt.Sprintf("%s:%d", entry.Username, entry.Rank))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: got %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCombinedSearchReadsTheSnapshot(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	if _, err := a.store.SetRatingByUsername("user_004", 4500); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(a, http.MethodGet, "/search/combined?query=user_004", "", nil)
+	var body CombinedSearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Exact) != 1 || len(body.Prefix) != 1 {
+		t.Fatalf("got %d exact and %d prefix results, want 1 each", len(body.Exact), len(body.Prefix))
+	}
+	if body.Exact[0] != body.Prefix[0] || body.Exact[0].Rank != 5 || body.Exact[0].Rating != 3960 {
+		t.Fatalf("exact %+v and prefix %+v should both be the snapshot entry, rank 5 at 3960", body.Exact[0], body.Prefix[0])
+	}
+}
+
+func TestStreamedSearchHonorsMode(t *testing.T) {
+	a := newTestApp(t, testSeeds(30), nil)
+	var paged SearchResponse
+	rec := serve(a, http.MethodGet, "/search?query=_01&mode=contains&limit=50", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &paged); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, entry := range paged.Results {
+		want = append(want, entry.Username)
+	}
+
+	rec = serve(a, http.MethodGet, "/search?query=_01&mode=contains&stream=true", "", nil)
+	var got []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var entry LeaderboardEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Username != "" {
+			got = append(got, entry.Username)
+		}
+	}
+	if len(want) == 0 || strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("streamed %v, paged %v", got, want)
+	}
+
+	for _, target := range []string{"/search?query=user&mode=fuzzy&stream=true", "/search?query=u&mode=contains&stream=true"} {
+		if rec := serve(a, http.MethodGet, target, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want %d", target, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSearchLastModifiedFollowsTheSnapshot(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	// The last rating change is an hour old, but the snapshot was published
+	// just now, so search results are only as old as the publish.
+	a.store.lastUpdate.Store(time.Now().Add(-time.Hour))
+	a.store.RefreshSnapshot()
+	want := serve(a, http.MethodGet, "/leaderboard", "", nil).Header().Get("Last-Modified")
+	rec := serve(a, http.MethodGet, "/search?query=user", "", nil)
+	if got := rec.Header().Get("Last-Modified"); got != want {
+		t.Fatalf("/search Last-Modified %q, want the snapshot's %q", got, want)
+	}
+	stale := time.Now().Add(-30 * time.Minute).UTC().Format(http.TimeFormat)
+	rec = serve(a, http.MethodGet, "/search?query=user", "", http.Header{"If-Modified-Since": {stale}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d for a copy older than the snapshot, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestNewUserLookupBeforeSnapshot(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	if rec := serve(a, http.MethodPost, "/users", `{"username": "peak", "rating": 3985}`, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("adding a user: got %d: %s", rec.Code, rec.Body)
+	}
+	// No snapshot has been published since the add, so both routes must
+	// fall back to the live table.
+	var user UserResponse
+	rec := serve(a, http.MethodGet, "/user/peak", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("/user/peak: got %d: %s", rec.Code, rec.Body)
+	}
+	if user.Username != "peak" || user.Rank != 3 || user.Rating != 3985 || user.PeakRating != 3985 {
+		t.Fatalf("/user/peak served %+v, want peak ranked 3 at 3985", user)
+	}
+	var peak UserPeak
+	rec = serve(a, http.MethodGet, "/users/peak/peak", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &peak); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("/users/peak/peak: got %d: %s", rec.Code, rec.Body)
+	}
+	if peak.Username != "peak" || peak.PeakRating != 3985 {
+		t.Fatalf("/users/peak/peak served %+v", peak)
+	}
+	if rec := serve(a, http.MethodGet, "/users/nobody/peak", "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown user peak: got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestBatchRatingDryRunLeavesStateUnchanged(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), func(cfg *Config) { cfg.StrictRatings = true })
+	before := a.store.SnapshotView()
+	lastUpdate := a.store.LastUpdate()
+	body := `[{"username": "user_004", "rating": 4500}, {"username": "nobody", "rating": 2000}, {"username": "user_000", "rating": 999999}, {"username": "user_001", "rating": 3990}]`
+
+	rec := serve(a, http.MethodPost, "/users/ratings?dry_run=true", body, bearer(testAdminToken))
+	var response SetRatingsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("dry run: got %d: %s", rec.Code, rec.Body)
+	}
+	if !response.DryRun || response.Applied != 1 || len(response.Results) != 4 {
+		t.Fatalf("dry run reported %+v, want one change that would apply", response)
+	}
+	if got := response.Results[0]; !got.Found || !got.Applied || got.Rank != 1 || got.Rating != 4500 {
+		t.Errorf("user_004 preview %+v, want rank 1 at 4500", got)
+	}
+	if got := response.Results[1]; got.Found || got.Applied {
+		t.Errorf("unknown user preview %+v", got)
+	}
+	if got := response.Results[2]; !got.Found || got.Applied || got.Error == "" {
+		t.Errorf("out-of-range preview %+v, want a strict-mode error", got)
+	}
+	if got := response.Results[3]; !got.Found || got.Applied || got.Rank != 2 {
+		t.Errorf("unchanged rating preview %+v, want rank 2 and nothing to apply", got)
+	}
+
+	a.store.RefreshSnapshot()
+	if after := a.store.SnapshotView(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("dry run changed the board:\n got %v\nwant %v", after, before)
+	}
+	if !a.store.LastUpdate().Equal(lastUpdate) {
+		t.Fatal("dry run bumped the last update time")
+	}
+	if entry, _, _ := a.store.LookupUser("user_004"); entry.Rating != 3960 {
+		t.Fatalf("user_004 rated %d after a dry run, want 3960", entry.Rating)
+	}
+
+	rec = serve(a, http.MethodPost, "/users/ratings", body, bearer(testAdminToken))
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || response.DryRun || response.Applied != 1 {
+		t.Fatalf("applying the batch: got %d: %s", rec.Code, rec.Body)
+	}
+	if entry, _ := a.store.PreviewRating("user_004", 4500); entry.Rating != 4500 || entry.Rank != 1 {
+		t.Fatalf("user_004 is %+v after applying, want rank 1 at 4500", entry)
+	}
+}
+
+// discardWriter is a ResponseWriter that drops the body, so benchmarks
+// count only the handler's own allocations.
+type discardWriter struct{ header http.Header }
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// BenchmarkLeaderboardResponse encodes a 100-entry page the way /leaderboard
+// does, from a pooled entry slice into a pooled buffer, and the way it did
+// before pooling, from a fresh slice through an encoder on the writer.
+func BenchmarkLeaderboardResponse(b *testing.B) {
+	a := newTestApp(b, randomSeeds(10000, defaultMinRating, defaultMaxRating, 1), nil)
+	store := a.store
+	snap := store.currentSnapshot()
+	req := httptest.NewRequest(http.MethodGet, "/leaderboard?limit=100", nil)
+	response := func(entries []LeaderboardEntry) LeaderboardResponse {
+		return LeaderboardResponse{TotalUsers: len(snap.ids), Page: 3, PageSize: 100, Entries: entries}
+	}
+
+	b.Run("pooled", func(b *testing.B) {
+		w := &discardWriter{header: http.Header{}}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			pooled := getEntries()
+			*pooled = store.appendLeaderboardPage(*pooled, snap, 3, 100)
+			writeResponse(w, req, http.StatusOK, response(*pooled))
+			putEntries(pooled)
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		w := &discardWriter{header: http.Header{}}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			enc := json.NewEncoder(w)
+			if getQueryBool(req, "pretty", false) {
+				enc.SetIndent("", "  ")
+			}
+			if err := enc.Encode(response(store.leaderboardPage(snap, 3, 100))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkLeaderboardEndpoint serves /leaderboard through the whole
+// middleware chain.
+func BenchmarkLeaderboardEndpoint(b *testing.B) {
+	a := newTestApp(b, randomSeeds(10000, defaultMinRating, defaultMaxRating, 1), nil)
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		a.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/leaderboard?page=3&limit=100", nil))
+	}
+}
+
+func TestAddUserWithGroup(t *testing.T) {
+	a := newTestApp(t, testSeeds(3), nil)
+	for _, body := range []string{
+		`{"username": "red_one", "rating": 3000, "group": " red "}`,
+		`{"username": "plain", "rating": 3000}`,
+	} {
+		if rec := serve(a, http.MethodPost, "/users", body, nil); rec.Code != http.StatusCreated {
+			t.Fatalf("POST /users %s: got %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+	a.store.RefreshSnapshot()
+
+	rec := serve(a, http.MethodGet, "/leaderboard/grouped?top=10", "", nil)
+	var body GroupedLeaderboardResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	members := make(map[string][]string)
+	for _, group := range body.Groups {
+		for _, entry := range group.Entries {
+			members[group.Group] = append(members[group.Group], entry.Username)
+		}
+	}
+	if got := members["red"]; len(got) != 1 || got[0] != "red_one" {
+		t.Fatalf("red group = %v, want [red_one]", got)
+	}
+	if got := members[defaultGroup]; len(got) != 4 || !slices.Contains(got, "plain") {
+		t.Fatalf("default group = %v, want the 3 seeds and plain", got)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	t.Run("empty board", func(t *testing.T) {
+		a := newTestApp(t, nil, func(cfg *Config) { cfg.SeedUsers = 0 })
+		rec := serve(a, http.MethodGet, "/users", "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), `"entries":[]`) {
+			t.Fatalf("empty board did not list entries as []: %s", rec.Body)
+		}
+	})
+	t.Run("alphabetical", func(t *testing.T) {
+		a := newTestApp(t, []SeedUser{
+			{Username: "charlie", Rating: 3000},
+			{Username: "Bravo", Rating: 1000},
+			{Username: "alpha", Rating: 2000},
+			{Username: "Delta", Rating: 4000},
+		}, nil)
+		var got []string
+		for page := 1; page <= 2; page++ {
+			rec := serve(a, http.MethodGet, fmt.Sprintf("/users?page=%d&limit=3", page), "", nil)
+			var body LeaderboardResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range body.Entries {
+				got = append(got, entry.Username)
+			}
+		}
+		if want := []string{"alpha", "Bravo", "charlie", "Delta"}; !slices.Equal(got, want) {
+			t.Fatalf("users listed as %v, want %v", got, want)
+		}
+	})
+}
+
+func TestMaintenanceModeIsReversible(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), func(cfg *Config) { cfg.MaintenanceRetryAfter = 30 })
+	toggle := func(enabled bool) {
+		t.Helper()
+		body := fmt.Sprintf(`{"enabled": %t}`, enabled)
+		if rec := serve(a, http.MethodPost, "/admin/maintenance", body, bearer(testAdminToken)); rec.Code != http.StatusOK {
+			t.Fatalf("toggle maintenance to %t: got %d: %s", enabled, rec.Code, rec.Body)
+		}
+	}
+	gated := []struct {
+		method, target, body string
+	}{
+		{http.MethodGet, "/leaderboard", ""},
+		{http.MethodGet, "/user/user_001", ""},
+		{http.MethodPost, "/users", `{"username": "late", "rating": 1200}`},
+	}
+
+	toggle(true)
+	for _, tt := range gated {
+		rec := serve(a, tt.method, tt.target, tt.body, nil)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("%s %s in maintenance: got %d, want 503", tt.method, tt.target, rec.Code)
+		}
+		if rec.Header().Get("Retry-After") != "30" {
+			t.Fatalf("%s %s: Retry-After = %q, want 30", tt.method, tt.target, rec.Header().Get("Retry-After"))
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == "" {
+			t.Fatalf("%s %s: body %s is not a JSON error", tt.method, tt.target, rec.Body)
+		}
+	}
+	for _, target := range []string{"/health", "/status"} {
+		if rec := serve(a, http.MethodGet, target, "", nil); rec.Code != http.StatusOK {
+			t.Fatalf("%s in maintenance: got %d, want 200", target, rec.Code)
+		}
+	}
+	if _, _, found := a.store.LookupUser("late"); found {
+		t.Fatal("a write went through during maintenance")
+	}
+
+	toggle(false)
+	for _, tt := range gated {
+		if rec := serve(a, tt.method, tt.target, tt.body, nil); rec.Code >= http.StatusBadRequest {
+			t.Fatalf("%s %s after maintenance: got %d: %s", tt.method, tt.target, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestLeaderboardETagCycle(t *testing.T) {
+	a := newTestApp(t, testSeeds(10), nil)
+	first := serve(a, http.MethodGet, "/leaderboard?limit=5", "", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: got %d with ETag %q", first.Code, etag)
+	}
+
+	cached := serve(a, http.MethodGet, "/leaderboard?limit=5", "", http.Header{"If-None-Match": {etag}})
+	if cached.Code != http.StatusNotModified || cached.Body.Len() != 0 {
+		t.Fatalf("matching If-None-Match: got %d with %d body bytes, want an empty 304", cached.Code, cached.Body.Len())
+	}
+	if other := serve(a, http.MethodGet, "/leaderboard?limit=5&page=2", "", http.Header{"If-None-Match": {etag}}); other.Code != http.StatusOK {
+		t.Fatalf("another page reused the ETag: got %d", other.Code)
+	}
+
+	if rec := serve(a, http.MethodPut, "/users/user_009/rating", `{"rating": 4500}`, bearer(testAdminToken)); rec.Code != http.StatusOK {
+		t.Fatalf("rating change: got %d: %s", rec.Code, rec.Body)
+	}
+	a.store.RefreshSnapshot()
+
+	changed := serve(a, http.MethodGet, "/leaderboard?limit=5", "", http.Header{"If-None-Match": {etag}})
+	if changed.Code != http.StatusOK {
+		t.Fatalf("after a rating change: got %d, want 200", changed.Code)
+	}
+	if next := changed.Header().Get("ETag"); next == "" || next == etag {
+		t.Fatalf("ETag after the change = %q, want a new value (was %q)", next, etag)
+	}
+	var body LeaderboardResponse
+	if err := json.Unmarshal(changed.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Entries[0].Username != "user_009" {
+		t.Fatalf("top entry after the change = %q, want user_009", body.Entries[0].Username)
+	}
+}
+
+func TestRankLookupsWithUnknownsInterleaved(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	rec := serve(a, http.MethodPost, "/users/ranks", `{"usernames": ["user_002", "ghost", "USER_000", "nobody", "user_004"]}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var body UserRanksResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []UserRank{
+		{Username: "user_002", Rank: 3, Rating: 3980, Found: true},
+		{Username: "ghost"},
+		{Username: "user_000", Rank: 1, Rating: 4000, Found: true},
+		{Username: "nobody"},
+		{Username: "user_004", Rank: 5, Rating: 3960, Found: true},
+	}
+	if !slices.Equal(body.Results, want) {
+		t.Fatalf("results %+v, want %+v", body.Results, want)
+	}
+	tooMany := `{"usernames": [` + strings.TrimSuffix(strings.Repeat(`"user_000",`, maxRankBatch+1), ",") + `]}`
+	for _, bad := range []string{`{"usernames": []}`, tooMany} {
+		if rec := serve(a, http.MethodPost, "/users/ranks", bad, nil); rec.Code != http.StatusBadRequest {
+			t.Fatalf("batch of %d bytes: got %d, want 400", len(bad), rec.Code)
+		}
+	}
+
+	entries, _, err := a.store.EntriesAtRanks([]int{3, 1, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"user_002", "user_000", "user_004"} {
+		if entries[i].Username != want {
+			t.Fatalf("entry %d is %q, want %q", i, entries[i].Username, want)
+		}
+	}
+	if _, _, err := a.store.EntriesAtRanks([]int{1, 99, 2}); err == nil {
+		t.Fatal("a rank past the board was accepted")
+	}
+}
+
+func TestPausedUpdatesFreezeRatings(t *testing.T) {
+	a := newTestApp(t, testSeeds(50), func(cfg *Config) {
+		cfg.UpdatesPerTick = 20
+		cfg.TickMs = 2
+	})
+	toggle := func(enabled bool) map[string]any {
+		t.Helper()
+		rec := serve(a, http.MethodPost, "/admin/updates", fmt.Sprintf(`{"enabled": %t}`, enabled), bearer(testAdminToken))
+		var body map[string]any
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil {
+			t.Fatalf("toggle updates to %t: got %d: %s", enabled, rec.Code, rec.Body)
+		}
+		return body
+	}
+	ratings := func() string {
+		var buf strings.Builder
+		if err := a.store.SaveState(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if body := toggle(false); body["enabled"] != false {
+		t.Fatalf("pause answered %v", body)
+	}
+	// A tick that started before the pause may still land.
+	time.Sleep(20 * time.Millisecond)
+	frozen, applied := ratings(), a.store.UpdatesApplied()
+	time.Sleep(50 * time.Millisecond)
+	if ratings() != frozen || a.store.UpdatesApplied() != applied {
+		t.Fatal("ratings changed while updates were paused")
+	}
+
+	toggle(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for a.store.UpdatesApplied() == applied {
+		if time.Now().After(deadline) {
+			t.Fatal("updates did not resume")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLeaderboardDeltaSync(t *testing.T) {
+	a := newTestApp(t, testSeeds(10), nil)
+	delta := func(since uint64) LeaderboardDeltaResponse {
+		t.Helper()
+		rec := serve(a, http.MethodGet, fmt.Sprintf("/leaderboard/delta?n=5&since=%d", since), "", nil)
+		var body LeaderboardDeltaResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("since %d: got %d %s", since, rec.Code, rec.Body)
+		}
+		return body
+	}
+	names := func(entries []LeaderboardEntry) []string {
+		out := make([]string, len(entries))
+		for i, entry := range entries {
+			out[i] = fmt.Sprintf("%s#%d", entry.Username, entry.Rank)
+		}
+		return out
+	}
+	base := a.store.SnapshotVersion()
+
+	t.Run("fresh client", func(t *testing.T) {
+		body := delta(base)
+		if body.FullReload || body.Version != base || len(body.Changed) != 0 || len(body.Removed) != 0 {
+			t.Fatalf("up-to-date client got %+v", body)
+		}
+	})
+
+	t.Run("small delta", func(t *testing.T) {
+		if _, err := a.store.SetRatingByUsername("user_009", 3995); err != nil {
+			t.Fatal(err)
+		}
+		a.store.RefreshSnapshot()
+		body := delta(base)
+		want := []string{"user_009#2", "user_001#3", "user_002#4", "user_003#5"}
+		if body.FullReload || body.Version == base || !slices.Equal(names(body.Changed), want) || !slices.Equal(body.Removed, []string{"user_004"}) {
+			t.Fatalf("got full reload %v, changed %v, removed %v; want %v and [user_004]", body.FullReload, names(body.Changed), body.Removed, want)
+		}
+	})
+
+	t.Run("too old", func(t *testing.T) {
+		a.store.SetSnapshotHistory(1)
+		a.store.RefreshSnapshot()
+		for _, since := range []uint64{base, 0} {
+			body := delta(since)
+			if !body.FullReload || len(body.Changed) != 5 || body.Changed[0].Username != "user_000" || len(body.Removed) != 0 {
+				t.Fatalf("since %d: got full reload %v, changed %v, removed %v", since, body.FullReload, names(body.Changed), body.Removed)
+			}
+		}
+	})
+}
+
+func TestBuildAppReturnsSeedErrors(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	tests := []struct {
+		name string
+		edit func(*Config)
+		want error
+	}{
+		{"duplicate seeds", func(cfg *Config) {
+			cfg.Seeds = []SeedUser{{Username: "Ann", Rating: 1500}, {Username: "ann", Rating: 1400}}
+		}, ErrUsernameTaken},
+		{"strict out of range", func(cfg *Config) {
+			cfg.Seeds = []SeedUser{{Username: "ann", Rating: cfg.MaxRating + 1}}
+			cfg.StrictRatings = true
+		}, ErrRatingOutOfRange},
+		{"missing seed file", func(cfg *Config) { cfg.SeedFile = filepath.Join(t.TempDir(), "missing.csv") }, os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.LogLevel = "error"
+			tt.edit(&cfg)
+			if a, err := buildAppWithConfig(cfg); a != nil || !errors.Is(err, tt.want) {
+				t.Fatalf("buildAppWithConfig: app %v, error %v; want %v", a != nil, err, tt.want)
+			}
+			if err := StartServerContext(context.Background(), cfg); !errors.Is(err, tt.want) {
+				t.Fatalf("StartServerContext: %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentileRoutes(t *testing.T) {
+	a := newTestApp(t, testSeeds(10), nil)
+	var user UserPercentile
+	if err := json.Unmarshal(serve(a, http.MethodGet, "/users/user_000/percentile", "", nil).Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "user_000" || user.Percentile != 0.9 {
+		t.Fatalf("top user: got %+v, want percentile 0.9", user)
+	}
+	if rec := serve(a, http.MethodGet, "/users/nobody/percentile", "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown user: got %d, want 404", rec.Code)
+	}
+
+	if body := serve(a, http.MethodGet, "/leaderboard", "", nil).Body.String(); strings.Contains(body, "percentile") {
+		t.Fatalf("percentile sent without include_percentile: %s", body)
+	}
+	for _, target := range []string{"/leaderboard?include_percentile=1", "/search?q=user&include_percentile=1"} {
+		var body struct {
+			Entries []LeaderboardEntry `json:"entries"`
+			Results []LeaderboardEntry `json:"results"`
+		}
+		if err := json.Unmarshal(serve(a, http.MethodGet, target, "", nil).Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		entries := append(body.Entries, body.Results...)
+		if len(entries) != 10 {
+			t.Fatalf("%s: %d entries", target, len(entries))
+		}
+		first, last := entries[0], entries[len(entries)-1]
+		// The bottom entry's 0 must still be sent, not omitted.
+		if first.Percentile == nil || *first.Percentile != 0.9 || last.Percentile == nil || *last.Percentile != 0 {
+			t.Fatalf("%s: top %v, bottom %v; want 0.9 and 0", target, first.Percentile, last.Percentile)
+		}
+	}
+}
+
+func TestCompareUsers(t *testing.T) {
+	a := newTestApp(t, testSeeds(10), nil)
+	tests := []struct {
+		name       string
+		query      string
+		status     int
+		error      string
+		ratingDiff int
+		rankDiff   int
+	}{
+		{"b behind a", "a=user_001&b=user_004", http.StatusOK, "", -30, 3},
+		{"b ahead of a", "a=USER_004&b=user_001", http.StatusOK, "", 30, -3},
+		{"same user", "a=user_002&b=user_002", http.StatusOK, "", 0, 0},
+		{"a missing", "a=ghost&b=user_001", http.StatusNotFound, `user "ghost" not found`, 0, 0},
+		{"b missing", "a=user_001&b=ghost", http.StatusNotFound, `user "ghost" not found`, 0, 0},
+		{"both missing", "a=ghost&b=phantom", http.StatusNotFound, `users "ghost" and "phantom" not found`, 0, 0},
+		{"b absent", "a=user_001", http.StatusBadRequest, "a and b usernames are required", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(a, http.MethodGet, "/compare?"+tt.query, "", nil)
+			if rec.Code != tt.status {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.error != "" {
+				var body map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] != tt.error {
+					t.Fatalf("error %q, want %q", body["error"], tt.error)
+				}
+				return
+			}
+			var result CompareResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.RatingDiff != tt.ratingDiff || result.RankDiff != tt.rankDiff {
+				t.Fatalf("rating diff %d, rank diff %d; want %d, %d", result.RatingDiff, result.RankDiff, tt.ratingDiff, tt.rankDiff)
+			}
+			if result.B.Rating-result.A.Rating != result.RatingDiff || result.B.Rank-result.A.Rank != result.RankDiff {
+				t.Fatalf("diffs do not match the entries: %+v", result)
+			}
+		})
+	}
+}
+
+func TestStrictRatingsOverHTTP(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		a := newTestApp(t, testSeeds(3), func(cfg *Config) { cfg.StrictRatings = strict })
+		wantStatus := map[bool]int{false: http.StatusCreated, true: http.StatusBadRequest}[strict]
+		if rec := serve(a, http.MethodPost, "/users", `{"username": "huge", "rating": 99999}`, nil); rec.Code != wantStatus {
+			t.Errorf("strict=%v POST /users: got %d %s, want %d", strict, rec.Code, rec.Body, wantStatus)
+		}
+		wantStatus = map[bool]int{false: http.StatusOK, true: http.StatusBadRequest}[strict]
+		rec := serve(a, http.MethodPut, "/users/user_000/rating", `{"rating": 1}`, bearer(testAdminToken))
+		if rec.Code != wantStatus {
+			t.Errorf("strict=%v PUT rating: got %d %s, want %d", strict, rec.Code, rec.Body, wantStatus)
+		}
+		if strict && !strings.Contains(rec.Body.String(), "rating is out of range: 1 is outside 100-5000") {
+			t.Errorf("strict PUT rating error %s does not name the bounds", rec.Body)
+		}
+		want := map[bool]int{false: defaultMinRating, true: 4000}[strict]
+		if got, _ := ratingOf(a.store, "user_000"); got != want {
+			t.Errorf("strict=%v: user_000 rated %d, want %d", strict, got, want)
+		}
+	}
+}
+
+func TestHealthBeforeAndAfterFirstSnapshot(t *testing.T) {
+	s, err := NewStore(testSeeds(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Ready() || s.SnapshotAge() != 0 {
+		t.Fatalf("a new store is ready %v with snapshot age %v", s.Ready(), s.SnapshotAge())
+	}
+	s.RefreshSnapshot()
+	if !s.Ready() {
+		t.Fatal("the store is not ready after its first snapshot")
+	}
+
+	a := newTestApp(t, testSeeds(7), nil)
+	health := func() (int, HealthResponse) {
+		t.Helper()
+		rec := serve(a, http.MethodGet, "/health", "", nil)
+		var body HealthResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, body
+	}
+
+	// buildAppWithConfig publishes the first snapshot before returning, so
+	// clear the flag to see the app as it is until then.
+	a.store.ready.Store(false)
+	code, body := health()
+	if want := (HealthResponse{Status: "starting", Users: 7, SnapshotAgeMs: body.SnapshotAgeMs, UpdatesEnabled: true}); code != http.StatusServiceUnavailable || body != want {
+		t.Fatalf("before the first snapshot: got %d %+v, want 503 %+v", code, body, want)
+	}
+
+	a.store.RefreshSnapshot()
+	code, body = health()
+	if code != http.StatusOK || body.Status != "ok" || body.Users != 7 || body.SnapshotAgeMs < 0 || !body.UpdatesEnabled {
+		t.Fatalf("after the first snapshot: got %d %+v", code, body)
+	}
+	a.store.SetUpdatesPaused(true)
+	if _, body = health(); body.UpdatesEnabled {
+		t.Fatal("updates_enabled stayed true while paused")
+	}
+}
+
+func TestProbesAcrossStates(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	probe := func(target string) (int, string) {
+		t.Helper()
+		rec := serve(a, http.MethodGet, target, "", nil)
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		status, _ := body["status"].(string)
+		return rec.Code, status
+	}
+	type result struct {
+		code   int
+		status string
+	}
+	states := []struct {
+		name  string
+		set   func()
+		probe map[string]result
+	}{
+		{"starting", func() { a.store.ready.Store(false) }, map[string]result{
+			"/healthz": {http.StatusOK, "ok"},
+			"/readyz":  {http.StatusServiceUnavailable, "starting"},
+			"/health":  {http.StatusServiceUnavailable, "starting"},
+		}},
+		{"steady", func() { a.store.RefreshSnapshot() }, map[string]result{
+			"/healthz": {http.StatusOK, "ok"},
+			"/readyz":  {http.StatusOK, "ok"},
+			"/health":  {http.StatusOK, "ok"},
+		}},
+		{"maintenance", func() { a.maintenance.Store(true) }, map[string]result{
+			"/healthz": {http.StatusOK, "ok"},
+			"/readyz":  {http.StatusOK, "ok"},
+			"/health":  {http.StatusOK, "ok"},
+		}},
+		{"draining", func() {
+			a.maintenance.Store(false)
+			a.draining.Store(true)
+		}, map[string]result{
+			"/healthz": {http.StatusOK, "ok"},
+			"/readyz":  {http.StatusServiceUnavailable, "draining"},
+			"/health":  {http.StatusServiceUnavailable, "draining"},
+		}},
+	}
+	for _, state := range states {
+		state.set()
+		for target, want := range state.probe {
+			if code, status := probe(target); code != want.code || status != want.status {
+				t.Errorf("%s %s: got %d %q, want %d %q", state.name, target, code, status, want.code, want.status)
+			}
+		}
+	}
+}
+
+func TestReadyzFailsWhileDraining(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cfg := DefaultConfig()
+	cfg.Port = strconv.Itoa(port)
+	cfg.Seeds = testSeeds(5)
+	cfg.UpdatesPerTick = 0
+	cfg.DrainDelayMs = 300
+	cfg.LogLevel = "error"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- StartServerContext(ctx, cfg) }()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	base := fmt.Sprintf("http://127.0.0.1:%d", port)
+	status := func(path string) int {
+		resp, err := client.Get(base + path)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for deadline := time.Now().Add(5 * time.Second); status("/readyz") != http.StatusOK; {
+		if time.Now().After(deadline) {
+			t.Fatal("server never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	for deadline := time.Now().Add(time.Second); status("/readyz") != http.StatusServiceUnavailable; {
+		if time.Now().After(deadline) {
+			t.Fatal("/readyz kept passing after shutdown started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz while draining: got %d, want 200", code)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("StartServerContext returned %v", err)
+	}
+}
+
+func TestBatchRatingsRoute(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	rec := serve(a, http.MethodPost, "/users/ratings", `[{"username": "user_004", "rating": 4500}, {"username": "ghost", "rating": 10}]`, bearer(testAdminToken))
+	var response SetRatingsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	if response.Applied != 1 || response.DryRun || !response.Results[0].Applied || response.Results[1].Found {
+		t.Fatalf("got %+v", response)
+	}
+
+	oversized := make([]RatingChange, maxRatingBatch+1)
+	for i := range oversized {
+		oversized[i] = RatingChange{Username: "user_000", Rating: 1000 + i}
+	}
+	tooMany, _ := json.Marshal(oversized)
+	for _, body := range []string{`[]`, `{"username": "user_000"}`, `[{"username": "user_000", "rating": 1`, string(tooMany)} {
+		if rec := serve(a, http.MethodPost, "/users/ratings", body, bearer(testAdminToken)); rec.Code != http.StatusBadRequest {
+			t.Errorf("body %.30q: got %d, want 400", body, rec.Code)
+		}
+	}
+	if rec := serve(a, http.MethodPost, "/users/ratings", `[{"username": "user_000", "rating": 1000}]`, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without the admin token: got %d, want 401", rec.Code)
+	}
+	if rating, _ := ratingOf(a.store, "user_000"); rating != 4000 {
+		t.Fatalf("a rejected batch moved user_000 to %d", rating)
+	}
+}
+
+func TestEntryAtPosition(t *testing.T) {
+	a := newTestApp(t, testSeeds(5), nil)
+	tests := []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{"position=0", http.StatusOK, "user_000"},
+		{"position=4", http.StatusOK, "user_004"},
+		{"position=5", http.StatusBadRequest, "position must be between 0 and 4"},
+		{"position=-1", http.StatusBadRequest, "position must be between 0 and 4"},
+		{"position=first", http.StatusBadRequest, "position must be an integer"},
+		{"", http.StatusBadRequest, "position must be an integer"},
+	}
+	for _, tt := range tests {
+		rec := serve(a, http.MethodGet, "/entry?"+tt.query, "", nil)
+		if rec.Code != tt.status {
+			t.Fatalf("%q: got %d %s, want %d", tt.query, rec.Code, rec.Body, tt.status)
+		}
+		if tt.status == http.StatusOK {
+			var body EntryResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Entry.Username != tt.want || body.Total != 5 || body.Version != a.store.SnapshotVersion() {
+				t.Fatalf("%q: got %+v", tt.query, body)
+			}
+			continue
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] != tt.want {
+			t.Fatalf("%q: error %q, want %q", tt.query, body["error"], tt.want)
+		}
+	}
+
+	empty := newTestApp(t, []SeedUser{}, nil)
+	rec := serve(empty, http.MethodGet, "/entry?position=0", "", nil)
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusNotFound || body["error"] != "leaderboard is empty" {
+		t.Fatalf("empty board: got %d %s, want 404 leaderboard is empty", rec.Code, rec.Body)
+	}
+}
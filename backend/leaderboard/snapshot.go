@@ -0,0 +1,1038 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type RankingMode string
+
+const (
+	RankingCompetition RankingMode = "competition"
+	RankingDense       RankingMode = "dense"
+	RankingOrdinal     RankingMode = "ordinal"
+)
+
+type snapshot struct {
+	version   uint64
+	ids       []int
+	ranks     []int32
+	ratings   []int32
+	positions []int32
+	// denseRanks holds every position's dense rank whatever the mode, for
+	// ?ranking=dense; in dense mode it shares ranks.
+	denseRanks []int32
+	mode       RankingMode
+	// publishedAt is when publishSnapshot made this the current snapshot.
+	publishedAt time.Time
+}
+
+func (s *Store) buildSnapshot() *snapshot {
+	mode := s.RankingMode()
+
+	s.lockAllBuckets()
+	defer s.unlockAllBuckets()
+
+	table := s.loadTable()
+	if workers := runtime.GOMAXPROCS(0); workers > 1 && len(table.usernameIndex) >= parallelSnapshotMinUsers {
+		s.sortBucketsParallel(table, workers)
+	}
+	snap := &snapshot{
+		ids:       make([]int, 0, len(table.usernameIndex)),
+		ranks:     make([]int32, 0, len(table.usernameIndex)),
+		ratings:   make([]int32, 0, len(table.usernameIndex)),
+		positions: make([]int32, len(table.users)),
+		mode:      mode,
+	}
+	if mode != RankingDense {
+		snap.denseRanks = make([]int32, 0, len(table.usernameIndex))
+	}
+	for id := range snap.positions {
+		snap.positions[id] = -1
+	}
+
+	first, last, step := s.maxRating, s.minRating, -1
+	if s.ascending {
+		first, last, step = s.minRating, s.maxRating, 1
+	}
+
+	distinct := 0
+	for rating := first; rating != last+step; rating += step {
+		bucket := s.ratingBuckets[rating-s.minRating]
+		if len(bucket) == 0 {
+			continue
+		}
+
+		ids := s.sortedBucket(table, rating-s.minRating)
+
+		distinct++
+		above := len(snap.ids)
+		for i, id := range ids {
+			snap.positions[id] = int32(above + i)
+			snap.ratings = append(snap.ratings, int32(rating))
+			switch mode {
+			case RankingDense:
+				snap.ranks = append(snap.ranks, int32(distinct))
+			case RankingOrdinal:
+				snap.ranks = append(snap.ranks, int32(above+i+1))
+			default:
+				snap.ranks = append(snap.ranks, int32(above+1))
+			}
+			if mode != RankingDense {
+				snap.denseRanks = append(snap.denseRanks, int32(distinct))
+			}
+		}
+		snap.ids = append(snap.ids, ids...)
+	}
+	if mode == RankingDense {
+		snap.denseRanks = snap.ranks
+	}
+
+	return snap
+}
+
+// TieBreak orders two users with the same rating by user ID, reporting
+// whether a goes before b. IDs follow seed order and then the order users
+// were added, so TieBreakByID ranks earlier joiners first.
+type TieBreak func(a, b int) bool
+
+// TieBreakByID breaks ties by join order.
+func TieBreakByID(a, b int) bool {
+	return a < b
+}
+
+// UsernameTieBreak breaks ties by normalized username, descending when
+// reverse is set. The ascending order is the default.
+func (s *Store) UsernameTieBreak(reverse bool) TieBreak {
+	return func(a, b int) bool {
+		table := s.loadTable()
+		if reverse {
+			return table.usernameLower[a] > table.usernameLower[b]
+		}
+		return table.usernameLower[a] < table.usernameLower[b]
+	}
+}
+
+// namedTieBreak resolves a TIE_BREAK setting; "" and "username" are the
+// default order and return nil.
+func (s *Store) namedTieBreak(name string) (TieBreak, error) {
+	switch name {
+	case "", "username":
+		return nil, nil
+	case "username_desc":
+		return s.UsernameTieBreak(true), nil
+	case "id":
+		return TieBreakByID, nil
+	default:
+		return nil, fmt.Errorf("unknown tie break %q", name)
+	}
+}
+
+// SetTieBreak replaces the order of users who share a rating; nil restores
+// username order. Every bucket is re-sorted on the next refresh.
+func (s *Store) SetTieBreak(less TieBreak) {
+	s.lockAllBuckets()
+	defer s.unlockAllBuckets()
+	s.tieBreak = less
+	for i := range s.dirtyBuckets {
+		s.dirtyBuckets[i] = true
+	}
+	s.snapshotDirty.Store(true)
+}
+
+// sortedBucket returns the bucket's IDs in tie-break order, re-sorting only
+// when updateUserRating has touched the bucket since the last build. The
+// caller must hold the bucket's shard.
+func (s *Store) sortedBucket(table *userTable, ratingIdx int) []int {
+	if !s.dirtyBuckets[ratingIdx] && s.sortedBuckets[ratingIdx] != nil {
+		return s.sortedBuckets[ratingIdx]
+	}
+	bucket := s.ratingBuckets[ratingIdx]
+	ids := append(s.sortedBuckets[ratingIdx][:0], bucket...)
+	if len(ids) > 1 && s.tieBreak != nil {
+		sort.Slice(ids, func(i, j int) bool {
+			return s.tieBreak(ids[i], ids[j])
+		})
+	} else if len(ids) > 1 {
+		sort.Slice(ids, func(i, j int) bool {
+			return table.usernameLower[ids[i]] < table.usernameLower[ids[j]]
+		})
+	}
+	s.sortedBuckets[ratingIdx] = ids
+	s.dirtyBuckets[ratingIdx] = false
+	return ids
+}
+
+// sortBucketsParallel brings every non-empty bucket's sorted copy up to date
+// on workers goroutines, which claim contiguous chunks of the rating range
+// in turn. Buckets are sorted independently and the walk in buildSnapshot
+// still concatenates them in rating order, so the result is the same as the
+// serial path. The caller must hold every shard.
+func (s *Store) sortBucketsParallel(table *userTable, workers int) {
+	buckets := len(s.ratingBuckets)
+	chunk := max(buckets/(workers*4), 1)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				start := int(next.Add(int64(chunk))) - chunk
+				if start >= buckets {
+					return
+				}
+				for ratingIdx := start; ratingIdx < min(start+chunk, buckets); ratingIdx++ {
+					if len(s.ratingBuckets[ratingIdx]) > 0 {
+						s.sortedBucket(table, ratingIdx)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// RefreshSnapshot rebuilds and publishes the snapshot. The dirty flag is
+// cleared before the build, so a change racing it marks the store dirty
+// again and is picked up on the next tick.
+func (s *Store) RefreshSnapshot() {
+	s.snapshotDirty.Store(false)
+	if s.tracer == nil {
+		s.publishSnapshot(s.timedBuildSnapshot())
+		return
+	}
+	_, span := s.tracer.tracer.Start(context.Background(), "snapshot.build")
+	snap := s.timedBuildSnapshot()
+	s.publishSnapshot(snap)
+	span.SetAttributes(
+		attribute.Int("snapshot.users", len(snap.ids)),
+		attribute.Int64("snapshot.version", int64(snap.version)),
+		attribute.String("snapshot.ranking_mode", string(snap.mode)),
+	)
+	span.End()
+}
+
+// timedBuildSnapshot builds a snapshot and records how long that took.
+func (s *Store) timedBuildSnapshot() *snapshot {
+	start := time.Now()
+	snap := s.buildSnapshot()
+	s.buildTimes.record(time.Since(start))
+	return snap
+}
+
+// SnapshotModified is the Last-Modified time for snapshot-backed reads: the
+// later of the last rating change and the last publish, since a change
+// reaches readers only when a later snapshot is published.
+func (s *Store) SnapshotModified() time.Time {
+	last := s.LastUpdate()
+	if published := s.currentSnapshot().publishedAt; published.After(last) {
+		return published
+	}
+	return last
+}
+
+func (s *Store) publishSnapshot(snap *snapshot) {
+	s.historyMu.Lock()
+	snap.version = atomic.AddUint64(&s.snapshotSeq, 1)
+	snap.publishedAt = time.Now()
+	s.snapshot.Store(snap)
+	if s.historyLimit > 0 {
+		s.history = append(s.history, snap)
+		if len(s.history) > s.historyLimit {
+			s.history[0] = nil
+			s.history = s.history[1:]
+		}
+	}
+	s.historyMu.Unlock()
+	s.ready.Store(true)
+
+	s.notifySubscribers(snap.version)
+}
+
+// Ready reports whether a snapshot has been published, so leaderboard pages
+// have something to serve.
+func (s *Store) Ready() bool {
+	return s.ready.Load()
+}
+
+// SnapshotAge is how long ago the served snapshot was published, or 0
+// before the first one.
+func (s *Store) SnapshotAge() time.Duration {
+	snap := s.currentSnapshot()
+	if snap.publishedAt.IsZero() {
+		return 0
+	}
+	return time.Since(snap.publishedAt)
+}
+
+// Subscribe registers for snapshot refresh notifications: every publish
+// sends the new version on the returned channel. A subscriber still holding
+// an unread version skips the newer one instead of blocking the refresh, so
+// readers should load the current snapshot on receipt. cancel unregisters
+// the channel and must be called when the subscriber goes away.
+func (s *Store) Subscribe() (<-chan uint64, func()) {
+	ch := make(chan uint64, 1)
+	s.subscribersMu.Lock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan uint64]struct{})
+	}
+	s.subscribers[ch] = struct{}{}
+	s.subscribersMu.Unlock()
+
+	cancel := func() {
+		s.subscribersMu.Lock()
+		delete(s.subscribers, ch)
+		s.subscribersMu.Unlock()
+	}
+	return ch, cancel
+}
+
+// leaderboardEvent is the top n of the current snapshot as pushed to
+// stream and WebSocket subscribers.
+func (s *Store) leaderboardEvent(n int) LeaderboardEvent {
+	snap := s.currentSnapshot()
+	return LeaderboardEvent{
+		Version:    snap.version,
+		UpdatedAt:  s.LastUpdate().UTC().Format(time.RFC3339),
+		TotalUsers: len(snap.ids),
+		Entries:    s.leaderboardPage(snap, 1, n),
+	}
+}
+
+func (s *Store) notifySubscribers(version uint64) {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- version:
+		default:
+		}
+	}
+}
+
+func (s *Store) snapshotAt(version uint64) (*snapshot, bool) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	for _, snap := range s.history {
+		if snap.version == version {
+			return snap, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Store) SetSnapshotHistory(limit int) {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	if limit < 0 {
+		limit = 0
+	}
+	s.historyLimit = limit
+	if len(s.history) > limit {
+		s.history = append([]*snapshot(nil), s.history[len(s.history)-limit:]...)
+	}
+}
+
+func (s *Store) SnapshotVersion() uint64 {
+	return s.currentSnapshot().version
+}
+
+func (s *Store) currentSnapshot() *snapshot {
+	value := s.snapshot.Load()
+	if value == nil {
+		return &snapshot{}
+	}
+	return value.(*snapshot)
+}
+
+func (s *Store) SnapshotIDs() []int {
+	return s.currentSnapshot().ids
+}
+
+func (s *Store) RankingMode() RankingMode {
+	value := s.rankingMode.Load()
+	if value == nil {
+		return RankingCompetition
+	}
+	return value.(RankingMode)
+}
+
+// SetRankingMode switches how snapshot ranks are numbered. The served
+// snapshot keeps its ranks until the next refresh recomputes them.
+func (s *Store) SetRankingMode(mode RankingMode) error {
+	switch mode {
+	case RankingCompetition, RankingDense, RankingOrdinal:
+		s.rankingMode.Store(mode)
+		s.snapshotDirty.Store(true)
+		return nil
+	default:
+		return fmt.Errorf("unknown ranking mode %q", mode)
+	}
+}
+
+func (s *Store) LeaderboardPage(page int, limit int) []LeaderboardEntry {
+	return s.leaderboardPage(s.currentSnapshot(), page, limit)
+}
+
+func (s *Store) leaderboardPage(snap *snapshot, page int, limit int) []LeaderboardEntry {
+	return s.appendLeaderboardPage(nil, snap, page, limit)
+}
+
+// appendLeaderboardPage appends the page's entries to dst, returning nil
+// for a page past the end so empty pages encode the same whether or not dst
+// came from entryPool.
+func (s *Store) appendLeaderboardPage(dst []LeaderboardEntry, snap *snapshot, page int, limit int) []LeaderboardEntry {
+	if limit <= 0 {
+		limit = 20
+	}
+	if page <= 0 {
+		page = 1
+	}
+	return s.appendEntriesFrom(dst, snap, (page-1)*limit, limit)
+}
+
+// Top returns the first n entries of the current snapshot, or an empty
+// slice when the board is empty.
+func (s *Store) Top(n int) []LeaderboardEntry {
+	entries := s.entriesFrom(s.currentSnapshot(), 0, n)
+	if entries == nil {
+		return []LeaderboardEntry{}
+	}
+	return entries
+}
+
+// LeaderboardPageOrdered pages through the board by rating: ascending
+// lists the lowest ratings first, whichever rank direction is configured.
+// Entries keep their real rank, so the last-placed user still shows their
+// position on the full board.
+func (s *Store) LeaderboardPageOrdered(page int, limit int, ascending bool) []LeaderboardEntry {
+	return s.leaderboardPageOrdered(s.currentSnapshot(), page, limit, ascending)
+}
+
+func (s *Store) leaderboardPageOrdered(snap *snapshot, page int, limit int, ascending bool) []LeaderboardEntry {
+	return s.appendLeaderboardPageOrdered(nil, snap, page, limit, ascending)
+}
+
+func (s *Store) appendLeaderboardPageOrdered(dst []LeaderboardEntry, snap *snapshot, page int, limit int, ascending bool) []LeaderboardEntry {
+	if ascending == s.ascending {
+		return s.appendLeaderboardPage(dst, snap, page, limit)
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	if page <= 0 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+	if offset >= len(snap.ids) {
+		return nil
+	}
+	end := offset + limit
+	if end > len(snap.ids) {
+		end = len(snap.ids)
+	}
+
+	results := growEntries(dst, end-offset)
+	for i := offset; i < end; i++ {
+		entry, _ := s.entryAt(snap, len(snap.ids)-1-i)
+		results = append(results, entry)
+	}
+	return results
+}
+
+// setDenseRanks gives each entry of a page built by
+// appendLeaderboardPageOrdered its dense rank in snap, so the ranks agree
+// with the order served.
+func (s *Store) setDenseRanks(snap *snapshot, entries []LeaderboardEntry, page int, limit int, ascending bool) {
+	offset := (page - 1) * limit
+	for i := range entries {
+		pos := offset + i
+		if ascending != s.ascending {
+			pos = len(snap.ids) - 1 - pos
+		}
+		entries[i].Rank = int(snap.denseRanks[pos])
+	}
+}
+
+func (s *Store) entriesFrom(snap *snapshot, offset int, limit int) []LeaderboardEntry {
+	return s.appendEntriesFrom(nil, snap, offset, limit)
+}
+
+func (s *Store) appendEntriesFrom(dst []LeaderboardEntry, snap *snapshot, offset int, limit int) []LeaderboardEntry {
+	if offset < 0 || offset >= len(snap.ids) {
+		return nil
+	}
+	end := offset + limit
+	if end > len(snap.ids) {
+		end = len(snap.ids)
+	}
+
+	results := growEntries(dst, end-offset)
+	for pos := offset; pos < end; pos++ {
+		entry, _ := s.entryAt(snap, pos)
+		results = append(results, entry)
+	}
+
+	return results
+}
+
+// LeaderboardRange pages through the users whose snapshot rating lies in
+// [low, high], in board order. Like SearchPage it returns the entries, the
+// number of matches, and the page (clamped to the last one) with the page
+// count. Snapshot ratings are sorted, so the band is one contiguous run of
+// positions, and entries keep their global rank.
+func (s *Store) LeaderboardRange(low int, high int, page int, limit int) ([]LeaderboardEntry, int, int, int) {
+	if limit <= 0 {
+		limit = 20
+	}
+	snap := s.currentSnapshot()
+	start, end := s.ratingSpan(snap, s.clampRating(low), s.clampRating(high))
+	total := end - start
+	totalPages := calcTotalPages(total, limit)
+	page = clampPage(page, totalPages)
+	if total == 0 {
+		return nil, 0, page, totalPages
+	}
+
+	offset := (page - 1) * limit
+	count := limit
+	if offset+count > total {
+		count = total - offset
+	}
+	return s.entriesFrom(snap, start+offset, count), total, page, totalPages
+}
+
+// ratingSpan returns the snapshot positions [start, end) holding ratings in
+// [low, high].
+func (s *Store) ratingSpan(snap *snapshot, low int, high int) (int, int) {
+	n := len(snap.ratings)
+	if s.ascending {
+		start := sort.Search(n, func(i int) bool { return int(snap.ratings[i]) >= low })
+		end := sort.Search(n, func(i int) bool { return int(snap.ratings[i]) > high })
+		return start, end
+	}
+	start := sort.Search(n, func(i int) bool { return int(snap.ratings[i]) <= high })
+	end := sort.Search(n, func(i int) bool { return int(snap.ratings[i]) < low })
+	return start, end
+}
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor snapshot is no longer retained; restart from page 1")
+)
+
+// leaderboardCursor marks the last position a client has read in a given
+// snapshot. It travels as unpadded URL-safe base64 of its JSON form.
+type leaderboardCursor struct {
+	Version  uint64 `json:"v"`
+	Position int    `json:"p"`
+}
+
+func encodeCursor(version uint64, position int) string {
+	raw, _ := json.Marshal(leaderboardCursor{Version: version, Position: position})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(value string) (leaderboardCursor, error) {
+	var cursor leaderboardCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(raw, &cursor) != nil || cursor.Position < 0 {
+		return leaderboardCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// nextCursor returns the cursor following a page of count entries read
+// from offset, or "" when that page reached the end of the snapshot.
+func (snap *snapshot) nextCursor(offset int, count int) string {
+	last := offset + count - 1
+	if count == 0 || last+1 >= len(snap.ids) {
+		return ""
+	}
+	return encodeCursor(snap.version, last)
+}
+
+// LeaderboardAfter returns up to limit entries following the cursor's
+// position, read from the same snapshot the cursor was issued for so deep
+// scrolling never skips or repeats a row. The snapshot must still be in the
+// history ring; otherwise ErrCursorExpired tells the client to restart.
+func (s *Store) LeaderboardAfter(cursor string, limit int) ([]LeaderboardEntry, string, uint64, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	decoded, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	snap := s.currentSnapshot()
+	if snap.version != decoded.Version {
+		var ok bool
+		snap, ok = s.snapshotAt(decoded.Version)
+		if !ok {
+			return nil, "", 0, ErrCursorExpired
+		}
+	}
+	if decoded.Position >= len(snap.ids) {
+		return nil, "", 0, ErrInvalidCursor
+	}
+
+	offset := decoded.Position + 1
+	entries := s.entriesFrom(snap, offset, limit)
+	if entries == nil {
+		entries = []LeaderboardEntry{}
+	}
+	return entries, snap.nextCursor(offset, len(entries)), snap.version, nil
+}
+
+// Around returns the user's snapshot entry with up to radius neighbours on
+// each side, clamped at both ends of the board, and the index of the user
+// within the returned slice.
+func (s *Store) Around(username string, radius int) ([]LeaderboardEntry, int, bool) {
+	id, ok := s.findUserID(username)
+	if !ok {
+		return nil, 0, false
+	}
+	snap := s.currentSnapshot()
+	position := snap.position(id)
+	if position < 0 {
+		return nil, 0, false
+	}
+	if radius < 0 {
+		radius = 0
+	}
+
+	start := position - radius
+	if start < 0 {
+		start = 0
+	}
+	end := position + radius + 1
+	if end > len(snap.ids) {
+		end = len(snap.ids)
+	}
+
+	results := make([]LeaderboardEntry, 0, end-start)
+	for pos := start; pos < end; pos++ {
+		entry, _ := s.entryAt(snap, pos)
+		results = append(results, entry)
+	}
+	return results, position - start, true
+}
+
+func (snap *snapshot) position(id int) int {
+	if id < 0 || id >= len(snap.positions) {
+		return -1
+	}
+	return int(snap.positions[id])
+}
+
+// PageOf returns the leaderboard page, of limit entries each, that holds
+// username in the current snapshot. Users added since the last refresh are
+// not on any page yet.
+func (s *Store) PageOf(username string, limit int) (int, bool) {
+	return s.pageOf(s.currentSnapshot(), username, limit, false)
+}
+
+func (s *Store) pageOf(snap *snapshot, username string, limit int, reversed bool) (int, bool) {
+	if limit <= 0 {
+		limit = 20
+	}
+	id, ok := s.findUserID(username)
+	if !ok {
+		return 0, false
+	}
+	pos := snap.position(id)
+	if pos < 0 {
+		return 0, false
+	}
+	if reversed {
+		pos = len(snap.ids) - 1 - pos
+	}
+	return pos/limit + 1, true
+}
+
+func (s *Store) EntryAt(position int) (LeaderboardEntry, bool) {
+	return s.entryAt(s.currentSnapshot(), position)
+}
+
+// entryAt renders the entry at a snapshot position with the rating frozen
+// at build time, so rank, rating and position always agree with each other
+// even while live updates continue.
+func (s *Store) entryAt(snap *snapshot, position int) (LeaderboardEntry, bool) {
+	if position < 0 || position >= len(snap.ids) {
+		return LeaderboardEntry{}, false
+	}
+	id := snap.ids[position]
+	return LeaderboardEntry{
+		Rank:     int(snap.ranks[position]),
+		Username: s.loadTable().users[id].Username,
+		Rating:   int(snap.ratings[position]),
+	}, true
+}
+
+// RankRange returns snapshot positions from through to, counted from 1 like
+// ranks, with to clamped to the board size and to at most maxRankRangeSpan
+// positions past from. It returns the resolved from and to; to is below from
+// when from is past the last position. Inside ties an entry's Rank can differ
+// from its position.
+func (s *Store) RankRange(from, to int) ([]LeaderboardEntry, int, int) {
+	snap := s.currentSnapshot()
+	from = max(from, 1)
+	to = min(to, len(snap.ids), from+maxRankRangeSpan-1)
+	if to < from {
+		return []LeaderboardEntry{}, from, to
+	}
+	return s.entriesFrom(snap, from-1, to-from+1), from, to
+}
+
+// EntryAtRank returns the entry at board position rank, counted from 1, in
+// the current snapshot. As with EntriesAtRanks, the entry's Rank can be
+// lower than the position asked for inside ties.
+func (s *Store) EntryAtRank(rank int) (LeaderboardEntry, bool) {
+	return s.entryAt(s.currentSnapshot(), rank-1)
+}
+
+// FillNeighbors sets Above and Below on each entry to the users directly
+// ahead of and behind it in the current snapshot. The side past either end
+// of the board, and both sides of a user not in the snapshot yet, stay nil.
+func (s *Store) FillNeighbors(entries []LeaderboardEntry) {
+	snap := s.currentSnapshot()
+	table := s.loadTable()
+	for i := range entries {
+		id, ok := table.findID(entries[i].Username)
+		if !ok {
+			continue
+		}
+		pos := snap.position(id)
+		if pos < 0 {
+			continue
+		}
+		if above, ok := s.entryAt(snap, pos-1); ok {
+			entries[i].Above = &above
+		}
+		if below, ok := s.entryAt(snap, pos+1); ok {
+			entries[i].Below = &below
+		}
+	}
+}
+
+// EntriesAtRanks maps each requested rank to snapshot position rank-1 and
+// returns the entry found there, in request order. The entry's Rank is the
+// user's actual rank, which differs from the requested one inside ties.
+func (s *Store) EntriesAtRanks(ranks []int) ([]RankedEntry, uint64, error) {
+	snap := s.currentSnapshot()
+	results := make([]RankedEntry, 0, len(ranks))
+	for _, rank := range ranks {
+		entry, ok := s.entryAt(snap, rank-1)
+		if !ok {
+			return nil, snap.version, fmt.Errorf("rank %d is outside 1-%d", rank, len(snap.ids))
+		}
+		results = append(results, RankedEntry{RequestedRank: rank, LeaderboardEntry: entry})
+	}
+	return results, snap.version, nil
+}
+
+// CheckConsistency compares, for snapshot positions [offset, offset+limit),
+// the competition rank implied by the snapshot ordering with the rank that
+// rank() derives from live counts and the user's live rating. Entries whose
+// ranks differ by more than tolerance are reported.
+func (s *Store) CheckConsistency(offset int, limit int, tolerance int) ConsistencyReport {
+	snap := s.currentSnapshot()
+	report := ConsistencyReport{Version: snap.version, Offset: offset, Tolerance: tolerance, Mismatches: []RankMismatch{}}
+	if offset < 0 || offset >= len(snap.ids) || limit <= 0 {
+		return report
+	}
+	end := offset + limit
+	if end > len(snap.ids) {
+		end = len(snap.ids)
+	}
+
+	table := s.loadTable()
+	groupStart := offset
+	for groupStart > 0 && snap.ratings[groupStart-1] == snap.ratings[offset] {
+		groupStart--
+	}
+	for pos := offset; pos < end; pos++ {
+		if pos > 0 && snap.ratings[pos] != snap.ratings[pos-1] {
+			groupStart = pos
+		}
+		snapshotRank := groupStart + 1
+		id := snap.ids[pos]
+		liveRating := int(atomic.LoadInt32(&table.ratings[id]))
+		liveRank := s.rank(liveRating)
+		report.Checked++
+
+		drift := liveRank - snapshotRank
+		if drift < 0 {
+			drift = -drift
+		}
+		if drift > report.MaxDrift {
+			report.MaxDrift = drift
+		}
+		if drift > tolerance {
+			report.Mismatches = append(report.Mismatches, RankMismatch{
+				Position:       pos,
+				Username:       table.users[id].Username,
+				SnapshotRank:   snapshotRank,
+				SnapshotRating: int(snap.ratings[pos]),
+				LiveRank:       liveRank,
+				LiveRating:     liveRating,
+				Drift:          drift,
+			})
+		}
+	}
+	return report
+}
+
+func (s *Store) GroupedLeaderboard(top int, maxEntries int) []GroupLeaderboard {
+	if top <= 0 {
+		top = 10
+	}
+	snap := s.currentSnapshot()
+	table := s.loadTable()
+
+	groups := make(map[string]*GroupLeaderboard)
+	lastRating := make(map[string]int)
+	emitted := 0
+	for pos, id := range snap.ids {
+		name := table.users[id].Group
+		group, ok := groups[name]
+		if !ok {
+			group = &GroupLeaderboard{Group: name, Entries: []LeaderboardEntry{}}
+			groups[name] = group
+		}
+		group.Members++
+		if len(group.Entries) >= top || (maxEntries > 0 && emitted >= maxEntries) {
+			continue
+		}
+
+		rating := int(snap.ratings[pos])
+		rank := group.Members
+		if len(group.Entries) > 0 && lastRating[name] == rating {
+			rank = group.Entries[len(group.Entries)-1].Rank
+		}
+		lastRating[name] = rating
+		group.Entries = append(group.Entries, LeaderboardEntry{
+			Rank:     rank,
+			Username: table.users[id].Username,
+			Rating:   rating,
+		})
+		emitted++
+	}
+
+	results := make([]GroupLeaderboard, 0, len(groups))
+	for _, group := range groups {
+		results = append(results, *group)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Group < results[j].Group
+	})
+
+	return results
+}
+
+// TopChanges diffs the first n positions of the retained snapshot at since
+// against the current snapshot. When since is no longer retained it returns
+// the whole current top n as entered and reports baseline=true.
+func (s *Store) TopChanges(n int, since uint64) ([]TopChange, uint64, bool) {
+	if n <= 0 {
+		n = 100
+	}
+	current := s.currentSnapshot()
+	table := s.loadTable()
+	newTop := topIDs(current, n)
+
+	previous, ok := s.snapshotAt(since)
+	if !ok {
+		changes := make([]TopChange, 0, len(newTop))
+		for pos, id := range newTop {
+			changes = append(changes, TopChange{
+				Username: table.users[id].Username,
+				Change:   "entered",
+				NewRank:  int(current.ranks[pos]),
+			})
+		}
+		return changes, current.version, true
+	}
+
+	oldTop := topIDs(previous, n)
+	inOld := make(map[int]bool, len(oldTop))
+	for _, id := range oldTop {
+		inOld[id] = true
+	}
+	inNew := make(map[int]bool, len(newTop))
+	for _, id := range newTop {
+		inNew[id] = true
+	}
+
+	entered := make(map[int]int)
+	for _, id := range newTop {
+		if !inOld[id] {
+			entered[id] = 0
+		}
+	}
+	left := make(map[int]int)
+	for _, id := range oldTop {
+		if !inNew[id] {
+			left[id] = 0
+		}
+	}
+	previous.fillRanks(entered)
+	current.fillRanks(left)
+
+	changes := make([]TopChange, 0, len(entered)+len(left))
+	for pos, id := range newTop {
+		if oldRank, ok := entered[id]; ok {
+			changes = append(changes, TopChange{
+				Username: table.users[id].Username,
+				Change:   "entered",
+				OldRank:  oldRank,
+				NewRank:  int(current.ranks[pos]),
+			})
+		}
+	}
+	for pos, id := range oldTop {
+		if newRank, ok := left[id]; ok {
+			changes = append(changes, TopChange{
+				Username: table.users[id].Username,
+				Change:   "left",
+				OldRank:  int(previous.ranks[pos]),
+				NewRank:  newRank,
+			})
+		}
+	}
+
+	return changes, current.version, false
+}
+
+// LeaderboardDelta lists the entries in the current top n whose rank or
+// rating differs from the retained snapshot at since, plus the users who
+// have dropped out of the top n. Deltas are computed from the snapshot
+// history on demand, so any retained version can be served. When since is
+// not retained the whole top n is returned with fullReload set, telling the
+// client to replace its state rather than patch it.
+func (s *Store) LeaderboardDelta(n int, since uint64) ([]LeaderboardEntry, []string, uint64, bool) {
+	if n <= 0 {
+		n = 100
+	}
+	current := s.currentSnapshot()
+	previous, ok := s.snapshotAt(since)
+	if !ok {
+		return s.entriesFrom(current, 0, n), []string{}, current.version, true
+	}
+
+	newTop := topIDs(current, n)
+	changed := []LeaderboardEntry{}
+	for pos, id := range newTop {
+		oldPos := previous.position(id)
+		if oldPos >= 0 && oldPos < n && previous.ranks[oldPos] == current.ranks[pos] && previous.ratings[oldPos] == current.ratings[pos] {
+			continue
+		}
+		entry, _ := s.entryAt(current, pos)
+		changed = append(changed, entry)
+	}
+
+	table := s.loadTable()
+	removed := []string{}
+	for _, id := range topIDs(previous, n) {
+		if pos := current.position(id); pos < 0 || pos >= n {
+			removed = append(removed, table.users[id].Username)
+		}
+	}
+	return changed, removed, current.version, false
+}
+
+func topIDs(snap *snapshot, n int) []int {
+	if n > len(snap.ids) {
+		n = len(snap.ids)
+	}
+	return snap.ids[:n]
+}
+
+func (snap *snapshot) fillRanks(ranks map[int]int) {
+	remaining := len(ranks)
+	for pos := 0; pos < len(snap.ids) && remaining > 0; pos++ {
+		if _, ok := ranks[snap.ids[pos]]; ok {
+			ranks[snap.ids[pos]] = int(snap.ranks[pos])
+			remaining--
+		}
+	}
+}
+
+func (s *Store) StartSnapshotLoop(ctx context.Context, tickMs int) {
+	if tickMs <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(tickMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.snapshotsPaused.Load() && s.snapshotDirty.Load() {
+				s.RefreshSnapshot()
+			}
+		}
+	}
+}
+
+// SetSnapshotsPaused freezes or resumes the periodic snapshot refresh.
+// Rating updates keep landing in the buckets while paused; resuming
+// rebuilds immediately so readers catch up without waiting for a tick.
+func (s *Store) SetSnapshotsPaused(paused bool) {
+	if s.snapshotsPaused.Swap(paused) && !paused {
+		s.RefreshSnapshot()
+	}
+}
+
+func (s *Store) SnapshotsPaused() bool {
+	return s.snapshotsPaused.Load()
+}
+
+// View returns the BoardView of the snapshot currently published.
+func (s *Store) View() BoardView {
+	return storeView{store: s, snap: s.currentSnapshot()}
+}
+
+// storeView is the BoardView of one snapshot of a Store.
+type storeView struct {
+	store *Store
+	snap  *snapshot
+}
+
+func (v storeView) Version() uint64 { return v.snap.version }
+
+func (v storeView) Len() int { return len(v.snap.ids) }
+
+func (v storeView) Ascending() bool { return v.store.ascending }
+
+func (v storeView) PageOf(username string, limit int, ascending bool) (int, bool) {
+	return v.store.pageOf(v.snap, username, limit, ascending != v.store.ascending)
+}
+
+func (v storeView) AppendPage(dst []LeaderboardEntry, page int, limit int, ascending bool) []LeaderboardEntry {
+	return v.store.appendLeaderboardPageOrdered(dst, v.snap, page, limit, ascending)
+}
+
+func (v storeView) SetDenseRanks(entries []LeaderboardEntry, page int, limit int, ascending bool) {
+	v.store.setDenseRanks(v.snap, entries, page, limit, ascending)
+}
+
+func (v storeView) NextCursor(offset int, count int) string {
+	return v.snap.nextCursor(offset, count)
+}
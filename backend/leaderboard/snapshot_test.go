@@ -0,0 +1,559 @@
+package leaderboard
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// referenceSnapshot builds the snapshot s should serve by sorting every
+// live user from scratch, without the rating buckets or their sorted
+// copies.
+func referenceSnapshot(s *Store) *snapshot {
+	table := s.loadTable()
+	var ids []int
+	for id := range table.users {
+		if !s.removed[id] {
+			ids = append(ids, id)
+		}
+	}
+	rating := func(id int) int32 { return atomic.LoadInt32(&table.ratings[id]) }
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ids[i], ids[j]
+		if rating(a) != rating(b) {
+			return (rating(a) > rating(b)) != s.ascending
+		}
+		if s.tieBreak != nil {
+			return s.tieBreak(a, b)
+		}
+		return table.usernameLower[a] < table.usernameLower[b]
+	})
+
+	mode := s.RankingMode()
+	snap := &snapshot{ids: ids, positions: make([]int32, len(table.users)), mode: mode}
+	for id := range snap.positions {
+		snap.positions[id] = -1
+	}
+	distinct, groupStart := 0, 0
+	for pos, id := range ids {
+		if pos == 0 || rating(id) != rating(ids[pos-1]) {
+			distinct++
+			groupStart = pos
+		}
+		snap.positions[id] = int32(pos)
+		snap.ratings = append(snap.ratings, rating(id))
+		snap.denseRanks = append(snap.denseRanks, int32(distinct))
+		switch mode {
+		case RankingDense:
+			snap.ranks = append(snap.ranks, int32(distinct))
+		case RankingOrdinal:
+			snap.ranks = append(snap.ranks, int32(pos+1))
+		default:
+			snap.ranks = append(snap.ranks, int32(groupStart+1))
+		}
+	}
+	return snap
+}
+
+// compareSnapshots fails the test at the first field where got differs
+// from want.
+func compareSnapshots(t testing.TB, got, want *snapshot) {
+	t.Helper()
+	if len(got.ids) != len(want.ids) {
+		t.Fatalf("snapshot has %d users, want %d", len(got.ids), len(want.ids))
+	}
+	for pos := range want.ids {
+		if got.ids[pos] != want.ids[pos] || got.ratings[pos] != want.ratings[pos] || got.ranks[pos] != want.ranks[pos] {
+			t.Fatalf("position %d: got id %d rating %d rank %d, want id %d rating %d rank %d",
+				pos, got.ids[pos], got.ratings[pos], got.ranks[pos], want.ids[pos], want.ratings[pos], want.ranks[pos])
+		}
+	}
+	if !slices.Equal(got.denseRanks, want.denseRanks) {
+		t.Fatalf("dense ranks differ:\n got %v\nwant %v", got.denseRanks, want.denseRanks)
+	}
+	if !slices.Equal(got.positions, want.positions) {
+		t.Fatalf("positions differ:\n got %v\nwant %v", got.positions, want.positions)
+	}
+}
+
+// withGOMAXPROCS runs fn with n Ps, which is what buildSnapshot checks
+// before taking the parallel path.
+func withGOMAXPROCS(n int, fn func()) {
+	previous := runtime.GOMAXPROCS(n)
+	defer runtime.GOMAXPROCS(previous)
+	fn()
+}
+
+func TestIncrementalSnapshotMatchesFullSort(t *testing.T) {
+	for _, mode := range []RankingMode{RankingCompetition, RankingDense, RankingOrdinal} {
+		for _, direction := range []RankDirection{RankDescending, RankAscending} {
+			t.Run(fmt.Sprintf("%s/%s", mode, direction), func(t *testing.T) {
+				s, err := NewStoreWithBounds(randomSeeds(400, 100, 160, 7), 100, 160)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.SetRankingMode(mode); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.SetRankDirection(direction); err != nil {
+					t.Fatal(err)
+				}
+				source := rand.New(rand.NewSource(11))
+				s.RefreshSnapshot()
+				compareSnapshots(t, s.currentSnapshot(), referenceSnapshot(s))
+
+				for round := 0; round < 50; round++ {
+					// Only a few buckets change per round, so most of the
+					// snapshot comes from the previous round's sorted copies.
+					applyRandomUpdates(s, source.Intn(20), source.Int63())
+					switch source.Intn(4) {
+					case 0:
+						if _, err := s.AddUser(fmt.Sprintf("joiner_%03d", round), 100+source.Intn(61)); err != nil {
+							t.Fatal(err)
+						}
+					case 1:
+						s.RemoveUser(fmt.Sprintf("player_%05d", source.Intn(400)))
+					}
+					s.RefreshSnapshot()
+					compareSnapshots(t, s.currentSnapshot(), referenceSnapshot(s))
+				}
+			})
+		}
+	}
+}
+
+func TestParallelSnapshotMatchesSerial(t *testing.T) {
+	seeds := randomSeeds(parallelSnapshotMinUsers+1000, 100, 400, 3)
+	tieBreaks := []string{"username", "username_desc", "id"}
+	for _, name := range tieBreaks {
+		t.Run(name, func(t *testing.T) {
+			build := func(procs int) *snapshot {
+				s, err := NewStoreWithBounds(seeds, 100, 400)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tieBreak, err := s.namedTieBreak(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.SetTieBreak(tieBreak)
+				applyRandomUpdates(s, 5000, 5)
+				var snap *snapshot
+				withGOMAXPROCS(procs, func() { snap = s.buildSnapshot() })
+				compareSnapshots(t, snap, referenceSnapshot(s))
+				return snap
+			}
+			compareSnapshots(t, build(4), build(1))
+		})
+	}
+}
+
+func TestPublishedSnapshotIsFrozen(t *testing.T) {
+	s, err := NewStoreWithBounds(randomSeeds(300, 100, 150, 9), 100, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetSnapshotHistory(4)
+	s.RefreshSnapshot()
+	published := s.currentSnapshot()
+	frozen := &snapshot{
+		ids:        slices.Clone(published.ids),
+		ranks:      slices.Clone(published.ranks),
+		denseRanks: slices.Clone(published.denseRanks),
+		ratings:    slices.Clone(published.ratings),
+		positions:  slices.Clone(published.positions),
+	}
+	version, publishedAt := published.version, published.publishedAt
+
+	source := rand.New(rand.NewSource(2))
+	for round := 0; round < 20; round++ {
+		applyRandomUpdates(s, 50, source.Int63())
+		if _, err := s.AddUser(fmt.Sprintf("late_%02d", round), 100+source.Intn(51)); err != nil {
+			t.Fatal(err)
+		}
+		s.RemoveUser(fmt.Sprintf("player_%05d", source.Intn(300)))
+		s.RefreshSnapshot()
+	}
+
+	if s.currentSnapshot() == published {
+		t.Fatal("no newer snapshot was published")
+	}
+	if published.version != version || !published.publishedAt.Equal(publishedAt) {
+		t.Fatalf("published snapshot metadata changed to version %d at %v", published.version, published.publishedAt)
+	}
+	compareSnapshots(t, published, frozen)
+}
+
+// refreshUnderLoad refreshes after each batch of the default 200 updates.
+// With full set, every bucket is re-sorted each time, as before
+// dirty-bucket tracking.
+func refreshUnderLoad(b *testing.B, full bool) {
+	s, err := NewStore(randomSeeds(10000, defaultMinRating, defaultMaxRating, 1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	source := rand.New(rand.NewSource(1))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		applyRandomUpdates(s, 200, source.Int63())
+		if full {
+			s.lockAllBuckets()
+			for idx := range s.dirtyBuckets {
+				s.dirtyBuckets[idx] = true
+			}
+			s.unlockAllBuckets()
+		}
+		b.StartTimer()
+		s.RefreshSnapshot()
+	}
+}
+
+func BenchmarkRefreshSnapshot(b *testing.B) {
+	b.Run("incremental", func(b *testing.B) { refreshUnderLoad(b, false) })
+	b.Run("full", func(b *testing.B) { refreshUnderLoad(b, true) })
+}
+
+// BenchmarkBuildSnapshotLarge re-sorts every bucket of a board above
+// parallelSnapshotMinUsers, with the parallel path and without it.
+func BenchmarkBuildSnapshotLarge(b *testing.B) {
+	s, err := NewStore(randomSeeds(200000, defaultMinRating, defaultMaxRating, 1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, procs := range []int{1, max(runtime.NumCPU(), 2)} {
+		name := "serial"
+		if procs > 1 {
+			name = fmt.Sprintf("parallel-%d", procs)
+		}
+		b.Run(name, func(b *testing.B) {
+			withGOMAXPROCS(procs, func() {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					s.SetTieBreak(nil)
+					b.StartTimer()
+					s.buildSnapshot()
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkLeaderboardPage(b *testing.B) {
+	s, err := NewStore(randomSeeds(100000, defaultMinRating, defaultMaxRating, 1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	snap := s.currentSnapshot()
+	pages := len(snap.ids) / 200
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.leaderboardPage(snap, 1+i%pages, 200)
+	}
+}
+
+func TestGroupedLeaderboardReadsTheSnapshot(t *testing.T) {
+	s, err := NewStore([]SeedUser{
+		{Username: "ana", Rating: 3000},
+		{Username: "ben", Rating: 2000},
+		{Username: "cai", Rating: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	if _, err := s.SetRatingByUsername("cai", 4000); err != nil {
+		t.Fatal(err)
+	}
+	groups := s.GroupedLeaderboard(10, 0)
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(groups))
+	}
+	var got []string
+	for _, entry := range groups[0].Entries {
+		got = append(got, fmt.Sprintf("%d:%s:%d", entry.Rank, entry.Username, entry.Rating))
+	}
+	if want := []string{"1:ana:3000", "2:ben:2000", "3:cai:1000"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestPrecomputedRanksMatchRank(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		for _, direction := range []RankDirection{RankDescending, RankAscending} {
+			s, err := NewStoreWithBounds(randomSeeds(800, 100, 100+int(seed)*40, seed), 100, 400)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetRankDirection(direction); err != nil {
+				t.Fatal(err)
+			}
+			applyRandomUpdates(s, 3000, seed)
+			s.RefreshSnapshot()
+
+			snap := s.currentSnapshot()
+			for pos, id := range snap.ids {
+				rating := int(snap.ratings[pos])
+				if want := s.rank(rating); int(snap.ranks[pos]) != want {
+					t.Fatalf("seed %d %s: position %d rated %d has snapshot rank %d, rank() says %d", seed, direction, pos, rating, snap.ranks[pos], want)
+				}
+				username := s.loadTable().users[id].Username
+				entry, _, ok := s.LookupUser(username)
+				if !ok || entry.Rank != s.rank(rating) {
+					t.Fatalf("seed %d %s: LookupUser(%q) rank %d, rank() says %d", seed, direction, username, entry.Rank, s.rank(rating))
+				}
+			}
+			for _, entry := range s.LeaderboardPage(3, 50) {
+				if entry.Rank != s.rank(entry.Rating) {
+					t.Fatalf("seed %d %s: page entry %q rank %d, rank() says %d", seed, direction, entry.Username, entry.Rank, s.rank(entry.Rating))
+				}
+			}
+			results, _, _, _ := s.SearchPage("player_00", 1, 100)
+			for _, entry := range results {
+				if entry.Rank != s.rank(entry.Rating) {
+					t.Fatalf("seed %d %s: search result %q rank %d, rank() says %d", seed, direction, entry.Username, entry.Rank, s.rank(entry.Rating))
+				}
+			}
+		}
+	}
+}
+
+func TestPausedSnapshotsKeepReadsStable(t *testing.T) {
+	s, err := NewStoreWithBounds(randomSeeds(500, 100, 400, 1), 100, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartSnapshotLoop(ctx, 2)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	s.SetSnapshotsPaused(true)
+	version := s.SnapshotVersion()
+	page := s.LeaderboardPage(1, 50)
+	for round := 0; round < 10; round++ {
+		applyRandomUpdates(s, 200, int64(round))
+		time.Sleep(5 * time.Millisecond)
+		if got := s.SnapshotVersion(); got != version {
+			t.Fatalf("round %d: snapshot version moved from %d to %d while paused", round, version, got)
+		}
+		if got := s.LeaderboardPage(1, 50); !slices.Equal(got, page) {
+			t.Fatalf("round %d: the first page changed while paused", round)
+		}
+	}
+
+	s.SetSnapshotsPaused(false)
+	if got := s.SnapshotVersion(); got <= version {
+		t.Fatalf("resuming left the snapshot at version %d", got)
+	}
+	compareSnapshots(t, s.currentSnapshot(), referenceSnapshot(s))
+}
+
+func TestTopWithTieAtN(t *testing.T) {
+	s, err := NewStoreWithBounds([]SeedUser{
+		{Username: "first", Rating: 500},
+		{Username: "second", Rating: 400},
+		{Username: "tied_a", Rating: 300},
+		{Username: "tied_b", Rating: 300},
+		{Username: "last", Rating: 200},
+	}, 100, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+
+	top := s.Top(3)
+	if len(top) != 3 {
+		t.Fatalf("Top(3) returned %d entries", len(top))
+	}
+	if top[2].Rank != 3 || top[2].Rating != 300 {
+		t.Fatalf("third entry %+v, want rank 3 at 300", top[2])
+	}
+	// The user tied with the third place shares its rank on the next page.
+	fourth := s.Top(4)[3]
+	if fourth.Rank != 3 || fourth.Username == top[2].Username {
+		t.Fatalf("fourth entry %+v, want the other tied user at rank 3", fourth)
+	}
+	if got := s.Top(5)[4]; got.Rank != 5 {
+		t.Fatalf("entry after the tie has rank %d, want 5", got.Rank)
+	}
+
+	empty, err := NewStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty.RefreshSnapshot()
+	if got := empty.Top(10); got == nil || len(got) != 0 {
+		t.Fatalf("Top on an empty board = %#v, want an empty slice", got)
+	}
+}
+
+func TestSnapshotLoopSkipsIdleTicks(t *testing.T) {
+	s, err := NewStore(randomSeeds(50, defaultMinRating, defaultMaxRating, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartSnapshotLoop(ctx, 2)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	idle := s.SnapshotVersion()
+	time.Sleep(30 * time.Millisecond)
+	if version := s.SnapshotVersion(); version != idle {
+		t.Fatalf("idle ticks advanced the version from %d to %d", idle, version)
+	}
+
+	if _, err := s.SetRatingByUsername("player_00000", defaultMaxRating); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for s.SnapshotVersion() == idle {
+		if time.Now().After(deadline) {
+			t.Fatal("a rating change was never picked up by the loop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	changed := s.SnapshotVersion()
+	time.Sleep(30 * time.Millisecond)
+	if version := s.SnapshotVersion(); version != changed {
+		t.Fatalf("one change was rebuilt more than once: version %d, then %d", changed, version)
+	}
+}
+
+func TestTieBreakOrdersTieCluster(t *testing.T) {
+	seeds := []SeedUser{
+		{Username: "dave", Rating: 2000},
+		{Username: "zed", Rating: 2500},
+		{Username: "Bob", Rating: 2000},
+		{Username: "carol", Rating: 2000},
+		{Username: "amy", Rating: 1500},
+		{Username: "alice", Rating: 2000},
+	}
+	order := func(s *Store) []string {
+		s.RefreshSnapshot()
+		snap, table := s.currentSnapshot(), s.loadTable()
+		names := make([]string, len(snap.ids))
+		for pos, id := range snap.ids {
+			names[pos] = fmt.Sprintf("%s#%d", table.users[id].Username, snap.ranks[pos])
+		}
+		return names
+	}
+	tests := []struct {
+		name     string
+		tieBreak func(s *Store) TieBreak
+		want     []string
+	}{
+		{"default username", func(*Store) TieBreak { return nil }, []string{"zed#1", "alice#2", "Bob#2", "carol#2", "dave#2", "late#2", "amy#7"}},
+		{"id", func(*Store) TieBreak { return TieBreakByID }, []string{"zed#1", "dave#2", "Bob#2", "carol#2", "alice#2", "late#2", "amy#7"}},
+		{"reverse username", func(s *Store) TieBreak { return s.UsernameTieBreak(true) }, []string{"zed#1", "late#2", "dave#2", "carol#2", "Bob#2", "alice#2", "amy#7"}},
+		{"injected newest first", func(*Store) TieBreak { return func(a, b int) bool { return a > b } }, []string{"zed#1", "late#2", "alice#2", "carol#2", "Bob#2", "dave#2", "amy#7"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewStore(seeds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			order(s)
+			if _, err := s.AddUser("late", 2000); err != nil {
+				t.Fatal(err)
+			}
+			s.SetTieBreak(tt.tieBreak(s))
+			if got := order(s); !slices.Equal(got, tt.want) {
+				t.Fatalf("order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAroundAndNeighborsAtEdges(t *testing.T) {
+	s, err := NewStore(testSeeds(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	names := func(entries []LeaderboardEntry) []string {
+		out := make([]string, len(entries))
+		for i, entry := range entries {
+			out[i] = fmt.Sprintf("%s#%d", entry.Username, entry.Rank)
+		}
+		return out
+	}
+
+	tests := []struct {
+		username string
+		radius   int
+		want     []string
+		index    int
+	}{
+		{"user_000", 2, []string{"user_000#1", "user_001#2", "user_002#3"}, 0},
+		{"user_001", 2, []string{"user_000#1", "user_001#2", "user_002#3", "user_003#4"}, 1},
+		{"user_005", 1, []string{"user_004#5", "user_005#6", "user_006#7"}, 1},
+		{"user_008", 2, []string{"user_006#7", "user_007#8", "user_008#9", "user_009#10"}, 2},
+		{"user_009", 2, []string{"user_007#8", "user_008#9", "user_009#10"}, 2},
+		{"user_004", 0, []string{"user_004#5"}, 0},
+		{"USER_004", -3, []string{"user_004#5"}, 0},
+		{"user_003", 50, names(s.entriesFrom(s.currentSnapshot(), 0, 10)), 3},
+	}
+	for _, tt := range tests {
+		entries, index, ok := s.Around(tt.username, tt.radius)
+		if !ok || index != tt.index || !slices.Equal(names(entries), tt.want) {
+			t.Errorf("Around(%s, %d) = %v at %d, %v; want %v at %d", tt.username, tt.radius, names(entries), index, ok, tt.want, tt.index)
+		}
+	}
+	if _, _, ok := s.Around("nobody", 2); ok {
+		t.Error("Around found an unknown user")
+	}
+
+	for rank, want := range map[int]string{1: "user_000", 10: "user_009"} {
+		if entry, ok := s.EntryAtRank(rank); !ok || entry.Username != want {
+			t.Errorf("EntryAtRank(%d) = %s, %v; want %s", rank, entry.Username, ok, want)
+		}
+	}
+	for _, rank := range []int{0, 11} {
+		if _, ok := s.EntryAtRank(rank); ok {
+			t.Errorf("EntryAtRank(%d) found an entry past the edge", rank)
+		}
+	}
+
+	entries := []LeaderboardEntry{{Username: "user_000"}, {Username: "user_004"}, {Username: "user_009"}, {Username: "nobody"}}
+	s.FillNeighbors(entries)
+	neighbor := func(entry *LeaderboardEntry) string {
+		if entry == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%s#%d", entry.Username, entry.Rank)
+	}
+	want := [][2]string{{"-", "user_001#2"}, {"user_003#4", "user_005#6"}, {"user_008#9", "-"}, {"-", "-"}}
+	for i, entry := range entries {
+		if got := [2]string{neighbor(entry.Above), neighbor(entry.Below)}; got != want[i] {
+			t.Errorf("%s: above/below %v, want %v", entry.Username, got, want[i])
+		}
+	}
+}
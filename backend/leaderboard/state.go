@@ -0,0 +1,134 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// stateFormatVersion is bumped whenever savedState changes incompatibly, so
+// an old file is rejected instead of half loaded.
+const stateFormatVersion = 1
+
+// savedState is the STATE_FILE format: every live user with their rating,
+// peak and group, and the bounds the ratings were saved under.
+type savedState struct {
+	Version   int         `json:"version"`
+	MinRating int         `json:"min_rating"`
+	MaxRating int         `json:"max_rating"`
+	Users     []savedUser `json:"users"`
+}
+
+type savedUser struct {
+	Username   string `json:"username"`
+	Rating     int    `json:"rating"`
+	PeakRating int    `json:"peak_rating"`
+	Group      string `json:"group,omitempty"`
+}
+
+// SaveState writes every live user as JSON, in username order. Ratings are
+// read one at a time, so stop the update loop first for a consistent file.
+func (s *Store) SaveState(w io.Writer) error {
+	table := s.loadTable()
+	state := savedState{
+		Version:   stateFormatVersion,
+		MinRating: s.minRating,
+		MaxRating: s.maxRating,
+		Users:     make([]savedUser, 0, len(table.usernameIndex)),
+	}
+	for _, entry := range table.usernameIndex {
+		user := table.users[entry.ID]
+		group := user.Group
+		if group == defaultGroup {
+			group = ""
+		}
+		state.Users = append(state.Users, savedUser{
+			Username:   user.Username,
+			Rating:     int(atomic.LoadInt32(&table.ratings[entry.ID])),
+			PeakRating: int(atomic.LoadInt32(&table.peakRatings[entry.ID])),
+			Group:      group,
+		})
+	}
+	return json.NewEncoder(w).Encode(state)
+}
+
+// LoadState builds a store with bounds min and max from a file written by
+// SaveState. Unlike seeds, saved users are not clamped: a rating outside the
+// bounds, a peak below the rating, an empty username, or a file from another
+// format version is an error, as is a duplicate username in NewStoreWithBounds.
+func LoadState(r io.Reader, min, max int) (*Store, error) {
+	var state savedState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return nil, fmt.Errorf("decoding state: %w", err)
+	}
+	if state.Version != stateFormatVersion {
+		return nil, fmt.Errorf("unsupported state version %d", state.Version)
+	}
+
+	seeds := make([]SeedUser, len(state.Users))
+	for i, user := range state.Users {
+		if user.Username == "" {
+			return nil, fmt.Errorf("user %d: empty username", i)
+		}
+		if user.Rating < min || user.Rating > max {
+			return nil, fmt.Errorf("user %q: rating %d outside %d-%d", user.Username, user.Rating, min, max)
+		}
+		if user.PeakRating < user.Rating || user.PeakRating > max {
+			return nil, fmt.Errorf("user %q: peak rating %d invalid for rating %d", user.Username, user.PeakRating, user.Rating)
+		}
+		seeds[i] = SeedUser{Username: user.Username, Rating: user.Rating, Group: user.Group}
+	}
+
+	store, err := NewStoreWithBounds(seeds, min, max)
+	if err != nil {
+		return nil, err
+	}
+	table := store.loadTable()
+	for id, user := range state.Users {
+		table.peakRatings[id] = int32(user.PeakRating)
+	}
+	return store, nil
+}
+
+// loadStateFile loads path with LoadState. A missing file returns a nil
+// store and no error, so a first boot falls through to the seeds.
+func loadStateFile(path string, min, max int) (*Store, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	store, err := LoadState(file, min, max)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return store, nil
+}
+
+// saveStateFile writes the store to a temporary file beside path and
+// renames it into place, so a crash mid-write leaves the previous state.
+func saveStateFile(store *Store, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := store.SaveState(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,85 @@
+package leaderboard
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	seeds := randomSeeds(300, 100, 400, 1)
+	seeds[0].Group = "red"
+	seeds[1].Group = "blue"
+	s, err := NewStoreWithBounds(seeds, 100, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyRandomUpdates(s, 1000, 2)
+	if !s.RemoveUser(seeds[2].Username) {
+		t.Fatal("could not remove a seeded user")
+	}
+	if _, err := s.AddUserWithGroup("late_joiner", 250, "green"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := saveStateFile(s, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadStateFile(path, 100, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after bytes.Buffer
+	if err := s.SaveState(&before); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.SaveState(&after); err != nil {
+		t.Fatal(err)
+	}
+	// SaveState lists every user with rating, peak and group, so equal
+	// output means nothing was lost.
+	if before.String() != after.String() {
+		t.Fatalf("reloaded state differs:\n%s\nvs\n%s", before.String(), after.String())
+	}
+	if loaded.UserCount() != 300 {
+		t.Fatalf("reloaded %d users, want 300", loaded.UserCount())
+	}
+	for _, username := range []string{seeds[0].Username, "late_joiner"} {
+		want, _ := s.PeakRating(username)
+		got, ok := loaded.PeakRating(username)
+		if !ok || got != want {
+			t.Fatalf("peak of %q = %+v, want %+v", username, got, want)
+		}
+	}
+	if _, _, found := loaded.LookupUser(seeds[2].Username); found {
+		t.Fatal("a removed user came back")
+	}
+}
+
+func TestLoadStateRejectsBadFiles(t *testing.T) {
+	missing, err := loadStateFile(filepath.Join(t.TempDir(), "absent.json"), 100, 400)
+	if missing != nil || err != nil {
+		t.Fatalf("missing file: store %v, error %v; want neither", missing, err)
+	}
+	tests := map[string]string{
+		"not json":         `{"version": 1,`,
+		"other version":    `{"version": 99, "users": []}`,
+		"rating too high":  `{"version": 1, "users": [{"username": "a", "rating": 500, "peak_rating": 500}]}`,
+		"peak below":       `{"version": 1, "users": [{"username": "a", "rating": 300, "peak_rating": 200}]}`,
+		"empty username":   `{"version": 1, "users": [{"username": "", "rating": 300, "peak_rating": 300}]}`,
+		"duplicate folded": `{"version": 1, "users": [{"username": "Ann", "rating": 300, "peak_rating": 300}, {"username": "ann", "rating": 200, "peak_rating": 200}]}`,
+	}
+	for name, body := range tests {
+		path := filepath.Join(t.TempDir(), "state.json")
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadStateFile(path, 100, 400); err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("%s: error %v, want one naming the file", name, err)
+		}
+	}
+}
@@ -0,0 +1,1116 @@
+package leaderboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	defaultMinRating = 100
+	defaultMaxRating = 5000
+
+	defaultGroup       = "default"
+	maxGroupedTop      = 100
+	maxGroupedEntries  = 2000
+	maxTopChangesN     = 1000
+	maxRankBatch       = 500
+	maxRatingBatch     = 1000
+	maxRankRangeSpan   = 500
+	maxSearchBodyBytes = 4 << 10
+	maxContextLimit    = 20
+	maxAroundRadius    = 50
+	sqlRowsPerInsert   = 500
+	minUsernameLength  = 3
+	maxUsernameLength  = 32
+	searchScanBudget   = 50000
+	minContainsLength  = 3
+	bucketShardCount   = 64
+	// parallelSnapshotMinUsers is the store size from which buildSnapshot
+	// sorts buckets on several goroutines; below it the serial walk is
+	// cheaper than starting them.
+	parallelSnapshotMinUsers = 50000
+	maxPrefixLength          = 16
+	maxHistogramBins         = 500
+	combinedLimit            = 5
+	maxCombinedLimit         = 10
+	maxPrefixTop             = 100
+
+	sseHeartbeatInterval = 15 * time.Second
+)
+
+type User struct {
+	ID       int
+	Username string
+	Group    string
+}
+
+type SeedUser struct {
+	Username string
+	Rating   int
+	Group    string
+}
+
+type UsernameIndex struct {
+	UsernameLower string
+	ID            int
+}
+
+// userTable holds the per-user columns, indexed by user ID, and the sorted
+// username index. Readers load it once per call; AddUser and RemoveUser
+// publish a new table while holding every bucket shard. The columns only
+// ever grow, so any table loaded after a snapshot covers every ID in it.
+// Ratings are only written under a bucket shard, which keeps a column copy
+// during growth from losing an update.
+type userTable struct {
+	users         []User
+	ratings       []int32
+	peakRatings   []int32
+	usernameLower []string
+	usernameIndex []UsernameIndex
+}
+
+var (
+	ErrUsernameRequired = errors.New("username is required")
+	ErrUsernameTaken    = errors.New("username is already taken")
+	ErrRatingOutOfRange = errors.New("rating is out of range")
+)
+
+// UsersNotFoundError names every username a lookup could not resolve.
+type UsersNotFoundError struct {
+	Usernames []string
+}
+
+func (e *UsersNotFoundError) Error() string {
+	quoted := make([]string, len(e.Usernames))
+	for i, username := range e.Usernames {
+		quoted[i] = fmt.Sprintf("%q", username)
+	}
+	if len(quoted) == 1 {
+		return fmt.Sprintf("user %s not found", quoted[0])
+	}
+	return fmt.Sprintf("users %s not found", strings.Join(quoted, " and "))
+}
+
+type Store struct {
+	table atomic.Pointer[userTable]
+
+	minRating    int
+	maxRating    int
+	ratingCounts []int64
+	ratingTree   ratingTree
+	distinctTree ratingTree
+
+	// bucketShards[i] guards the rating buckets whose index is i modulo
+	// bucketShardCount, with their sorted copies and dirty flags and the
+	// bucketIndex entries of the users in them. Growing the per-user columns
+	// or tombstoning a user takes every shard, in order.
+	bucketShards  [bucketShardCount]sync.Mutex
+	ratingBuckets [][]int
+	bucketIndex   []int
+	removed       []bool
+	sortedBuckets [][]int
+	dirtyBuckets  []bool
+
+	lastUpdate      atomic.Value
+	snapshot        atomic.Value
+	rankingMode     atomic.Value
+	snapshotsPaused atomic.Bool
+	updatesPaused   atomic.Bool
+	// strictRatings makes AddUser and SetRatingByUsername reject ratings
+	// outside the bounds instead of clamping them.
+	strictRatings atomic.Bool
+	// snapshotDirty is set by anything that changes what the next snapshot
+	// would hold, so the snapshot loop can skip idle ticks.
+	snapshotDirty atomic.Bool
+	// ready is set once the first snapshot is published.
+	ready atomic.Bool
+
+	snapshotSeq    uint64
+	updatesApplied uint64
+	historyMu      sync.Mutex
+	history        []*snapshot
+	historyLimit   int
+
+	subscribersMu sync.Mutex
+	subscribers   map[chan uint64]struct{}
+
+	moves   moveLog
+	watches *watchRegistry
+
+	createdAt   time.Time
+	buildTimes  durationWindow
+	updateTimes durationWindow
+	updateRate  rateCounter
+
+	tiers     []Tier
+	ascending bool
+	// tieBreak orders users within a rating; nil is username order. It is
+	// only swapped while holding every bucket shard.
+	tieBreak TieBreak
+
+	tracer *tracer
+}
+
+type RankDirection string
+
+const (
+	RankDescending RankDirection = "desc"
+	RankAscending  RankDirection = "asc"
+)
+
+// NewStore builds a store with the default rating bounds. It fails if two
+// seeds share a username, compared as AddUser and lookups do.
+func NewStore(seeds []SeedUser) (*Store, error) {
+	return NewStoreWithBounds(seeds, defaultMinRating, defaultMaxRating)
+}
+
+// NewStoreWithBounds builds a store whose ratings run from min to max
+// inclusive. Seed ratings outside the range are clamped into it; duplicate
+// usernames are an error wrapping ErrUsernameTaken.
+func NewStoreWithBounds(seeds []SeedUser, min, max int) (*Store, error) {
+	if min > max {
+		return nil, fmt.Errorf("min rating %d is above max rating %d", min, max)
+	}
+	if err := checkSeedUsernames(seeds); err != nil {
+		return nil, err
+	}
+	ratingRange := max - min + 1
+	store := &Store{
+		minRating:     min,
+		maxRating:     max,
+		ratingBuckets: make([][]int, ratingRange),
+		bucketIndex:   make([]int, len(seeds)),
+		removed:       make([]bool, len(seeds)),
+		sortedBuckets: make([][]int, ratingRange),
+		dirtyBuckets:  make([]bool, ratingRange),
+		ratingCounts:  make([]int64, ratingRange),
+		ratingTree:    newRatingTree(ratingRange),
+		distinctTree:  newRatingTree(ratingRange),
+		watches:       newWatchRegistry(),
+		createdAt:     time.Now(),
+	}
+	table := &userTable{
+		users:         make([]User, len(seeds)),
+		ratings:       make([]int32, len(seeds)),
+		peakRatings:   make([]int32, len(seeds)),
+		usernameLower: make([]string, len(seeds)),
+		usernameIndex: make([]UsernameIndex, len(seeds)),
+	}
+
+	for id, seed := range seeds {
+		rating := store.clampRating(seed.Rating)
+		group := strings.TrimSpace(seed.Group)
+		if group == "" {
+			group = defaultGroup
+		}
+		table.users[id] = User{ID: id, Username: seed.Username, Group: group}
+		table.ratings[id] = int32(rating)
+		table.peakRatings[id] = int32(rating)
+		table.usernameLower[id] = normalizeUsername(seed.Username)
+		table.usernameIndex[id] = UsernameIndex{UsernameLower: table.usernameLower[id], ID: id}
+		ratingIdx := rating - store.minRating
+		store.bucketIndex[id] = len(store.ratingBuckets[ratingIdx])
+		store.ratingBuckets[ratingIdx] = append(store.ratingBuckets[ratingIdx], id)
+		store.addCount(ratingIdx, 1)
+	}
+
+	sort.Slice(table.usernameIndex, func(i, j int) bool {
+		if table.usernameIndex[i].UsernameLower == table.usernameIndex[j].UsernameLower {
+			return table.usernameIndex[i].ID < table.usernameIndex[j].ID
+		}
+		return table.usernameIndex[i].UsernameLower < table.usernameIndex[j].UsernameLower
+	})
+
+	store.table.Store(table)
+	store.lastUpdate.Store(time.Now())
+	store.snapshot.Store(&snapshot{})
+	store.tiers = defaultTiers(min, max)
+	store.rankingMode.Store(RankingCompetition)
+
+	return store, nil
+}
+
+// checkSeedRatings is the strict-mode check for seeds, which the store
+// would otherwise clamp.
+func checkSeedRatings(seeds []SeedUser, min, max int) error {
+	for i, seed := range seeds {
+		if seed.Rating < min || seed.Rating > max {
+			return fmt.Errorf("seed %d %q: %w: %d is outside %d-%d", i, seed.Username, ErrRatingOutOfRange, seed.Rating, min, max)
+		}
+	}
+	return nil
+}
+
+// checkSeedUsernames reports the first seed whose normalized username
+// repeats an earlier one.
+func checkSeedUsernames(seeds []SeedUser) error {
+	first := make(map[string]int, len(seeds))
+	for i, seed := range seeds {
+		lower := normalizeUsername(seed.Username)
+		if j, ok := first[lower]; ok {
+			return fmt.Errorf("seed %d %q: %w by seed %d %q", i, seed.Username, ErrUsernameTaken, j, seeds[j].Username)
+		}
+		first[lower] = i
+	}
+	return nil
+}
+
+// RatingBounds returns the inclusive rating range the store clamps to.
+func (s *Store) RatingBounds() (int, int) {
+	return s.minRating, s.maxRating
+}
+
+func (s *Store) UserCount() int {
+	return len(s.loadTable().usernameIndex)
+}
+
+func (s *Store) loadTable() *userTable {
+	return s.table.Load()
+}
+
+func (s *Store) LastUpdate() time.Time {
+	value := s.lastUpdate.Load()
+	if value == nil {
+		return time.Time{}
+	}
+	return value.(time.Time)
+}
+
+func (s *Store) rank(rating int) int {
+	ratingIdx := s.clampRating(rating) - s.minRating
+	if s.ascending {
+		return int(s.ratingTree.prefix(ratingIdx-1)) + 1
+	}
+	total := s.ratingTree.prefix(len(s.ratingCounts) - 1)
+	return int(total-s.ratingTree.prefix(ratingIdx)) + 1
+}
+
+// DenseRank is the dense rank of rating: 1 + the number of distinct
+// ratings held by users ranked ahead of it, so ties never leave gaps.
+func (s *Store) DenseRank(rating int) int {
+	ratingIdx := s.clampRating(rating) - s.minRating
+	if s.ascending {
+		return int(s.distinctTree.prefix(ratingIdx-1)) + 1
+	}
+	total := s.distinctTree.prefix(len(s.ratingCounts) - 1)
+	return int(total-s.distinctTree.prefix(ratingIdx)) + 1
+}
+
+// addCount adjusts a bucket's user count and, when the bucket becomes empty
+// or stops being empty, the distinct-rating tree behind DenseRank.
+func (s *Store) addCount(ratingIdx int, delta int64) {
+	count := atomic.AddInt64(&s.ratingCounts[ratingIdx], delta)
+	s.ratingTree.add(ratingIdx, delta)
+	if before := count - delta; (before == 0) != (count == 0) {
+		if count == 0 {
+			s.distinctTree.add(ratingIdx, -1)
+		} else {
+			s.distinctTree.add(ratingIdx, 1)
+		}
+	}
+}
+
+// ratingTree is a Fenwick tree over rating indexes, so counting users above
+// or below a rating costs O(log range) instead of a walk over every bucket.
+// Nodes are updated atomically; like ratingCounts, a read racing an update
+// may observe it half applied.
+type ratingTree struct {
+	nodes []int64
+}
+
+func newRatingTree(size int) ratingTree {
+	return ratingTree{nodes: make([]int64, size+1)}
+}
+
+func (t ratingTree) add(idx int, delta int64) {
+	for i := idx + 1; i < len(t.nodes); i += i & -i {
+		atomic.AddInt64(&t.nodes[i], delta)
+	}
+}
+
+// prefix returns the number of users at rating indexes 0 through idx.
+func (t ratingTree) prefix(idx int) int64 {
+	if idx >= len(t.nodes)-1 {
+		idx = len(t.nodes) - 2
+	}
+	sum := int64(0)
+	for i := idx + 1; i > 0; i -= i & -i {
+		sum += atomic.LoadInt64(&t.nodes[i])
+	}
+	return sum
+}
+
+// countBetween returns how many users hold a rating in [low, high].
+func (s *Store) countBetween(low, high int) int64 {
+	return s.ratingTree.prefix(high-s.minRating) - s.ratingTree.prefix(low-s.minRating-1)
+}
+
+// Histogram splits the rating range into bucketCount contiguous bins of
+// near-equal width, in ascending order; the last bin ends at the store's
+// maximum rating.
+func (s *Store) Histogram(bucketCount int) []HistogramBin {
+	ratingRange := s.maxRating - s.minRating + 1
+	if bucketCount <= 0 {
+		bucketCount = 1
+	}
+	if bucketCount > ratingRange {
+		bucketCount = ratingRange
+	}
+
+	bins := make([]HistogramBin, bucketCount)
+	for i := range bins {
+		low := s.minRating + i*ratingRange/bucketCount
+		high := s.minRating + (i+1)*ratingRange/bucketCount - 1
+		bins[i] = HistogramBin{Min: low, Max: high, Count: s.countBetween(low, high)}
+	}
+	return bins
+}
+
+// Stats summarizes the live rating distribution from the per-rating counts,
+// reading each count once, so it needs neither the snapshot nor a bucket
+// lock.
+// With an even number of users the median is the mean of the two middle
+// ratings.
+func (s *Store) Stats() Stats {
+	counts := make([]int64, len(s.ratingCounts))
+	stats := Stats{UpdatedAt: s.LastUpdate().UTC().Format(time.RFC3339)}
+	var sum int64
+	for idx := range counts {
+		count := atomic.LoadInt64(&s.ratingCounts[idx])
+		if count <= 0 {
+			continue
+		}
+		counts[idx] = count
+		rating := s.minRating + idx
+		if stats.TotalUsers == 0 {
+			stats.MinRating = rating
+		}
+		stats.MaxRating = rating
+		stats.TotalUsers += count
+		sum += count * int64(rating)
+	}
+	if stats.TotalUsers == 0 {
+		return stats
+	}
+	stats.MeanRating = float64(sum) / float64(stats.TotalUsers)
+
+	// The median sits at 0-based positions (n-1)/2 and n/2 in rating order.
+	lowPos, highPos := (stats.TotalUsers-1)/2, stats.TotalUsers/2
+	lowRating, seen := -1, int64(0)
+	for idx, count := range counts {
+		seen += count
+		if lowRating < 0 && seen > lowPos {
+			lowRating = s.minRating + idx
+		}
+		if seen > highPos {
+			stats.MedianRating = float64(lowRating+s.minRating+idx) / 2
+			break
+		}
+	}
+	return stats
+}
+
+// ranksAhead reports whether rating a places strictly ahead of rating b
+// under the store's ranking direction.
+func (s *Store) ranksAhead(a, b int) bool {
+	if s.ascending {
+		return a < b
+	}
+	return a > b
+}
+
+func (s *Store) RankDirection() RankDirection {
+	if s.ascending {
+		return RankAscending
+	}
+	return RankDescending
+}
+
+// SetRankDirection chooses whether higher (desc) or lower (asc) ratings rank
+// first. Call it before the first RefreshSnapshot so ranks and snapshot
+// order agree.
+func (s *Store) SetRankDirection(direction RankDirection) error {
+	switch direction {
+	case RankDescending:
+		s.ascending = false
+	case RankAscending:
+		s.ascending = true
+	default:
+		return fmt.Errorf("unknown rank direction %q", direction)
+	}
+	return nil
+}
+
+func (s *Store) findUserID(username string) (int, bool) {
+	return s.loadTable().findID(username)
+}
+
+func (t *userTable) findID(username string) (int, bool) {
+	key := normalizeUsername(strings.TrimSpace(username))
+	if key == "" {
+		return 0, false
+	}
+	idx := sort.Search(len(t.usernameIndex), func(i int) bool {
+		return t.usernameIndex[i].UsernameLower >= key
+	})
+	if idx < len(t.usernameIndex) && t.usernameIndex[idx].UsernameLower == key {
+		return t.usernameIndex[idx].ID, true
+	}
+	return 0, false
+}
+
+// AddUser registers a new user at rating, clamped to the valid range or
+// rejected outside it under SetStrictRatings, and returns their live rank.
+// Usernames are unique case-insensitively. The new table and bucket entry
+// are published together under every bucket shard, so a snapshot build sees
+// the user either fully or not at all; the user appears on leaderboard pages
+// from the next refresh.
+func (s *Store) AddUser(username string, rating int) (int, error) {
+	return s.AddUserWithGroup(username, rating, "")
+}
+
+// AddUserWithGroup is AddUser placing the user in group, trimmed, or in the
+// default group when it is blank.
+func (s *Store) AddUserWithGroup(username string, rating int, group string) (int, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return 0, ErrUsernameRequired
+	}
+	if err := validateUsername(username); err != nil {
+		return 0, err
+	}
+	lower := normalizeUsername(username)
+	rating, err := s.checkRating(rating)
+	if err != nil {
+		return 0, err
+	}
+	ratingIdx := rating - s.minRating
+	group = strings.TrimSpace(group)
+	if group == "" {
+		group = defaultGroup
+	}
+
+	s.lockAllBuckets()
+	defer s.unlockAllBuckets()
+
+	current := s.loadTable()
+	if _, ok := current.findID(lower); ok {
+		return 0, ErrUsernameTaken
+	}
+	id := len(current.users)
+
+	// The index is shifted on insert, so it is copied rather than edited in
+	// place under readers still holding the current table.
+	pos := sort.Search(len(current.usernameIndex), func(i int) bool {
+		return current.usernameIndex[i].UsernameLower > lower
+	})
+	index := make([]UsernameIndex, 0, len(current.usernameIndex)+1)
+	index = append(index, current.usernameIndex[:pos]...)
+	index = append(index, UsernameIndex{UsernameLower: lower, ID: id})
+	index = append(index, current.usernameIndex[pos:]...)
+
+	next := &userTable{
+		users:         append(current.users, User{ID: id, Username: username, Group: group}),
+		ratings:       append(current.ratings, int32(rating)),
+		peakRatings:   append(current.peakRatings, int32(rating)),
+		usernameLower: append(current.usernameLower, lower),
+		usernameIndex: index,
+	}
+
+	s.bucketIndex = append(s.bucketIndex, len(s.ratingBuckets[ratingIdx]))
+	s.removed = append(s.removed, false)
+	s.ratingBuckets[ratingIdx] = append(s.ratingBuckets[ratingIdx], id)
+	s.dirtyBuckets[ratingIdx] = true
+	s.snapshotDirty.Store(true)
+	s.table.Store(next)
+	s.addCount(ratingIdx, 1)
+	s.lastUpdate.Store(time.Now())
+
+	return s.rank(rating), nil
+}
+
+// UsersAtRating pages through the users currently holding exactly rating,
+// ordered by username, and returns how many hold it and the page served: a
+// page past the end is clamped to the last one, as on /leaderboard. Entries
+// are read live from the rating bucket, not from the snapshot.
+func (s *Store) UsersAtRating(rating int, page int, limit int) ([]LeaderboardEntry, int, int) {
+	if rating < s.minRating || rating > s.maxRating {
+		return nil, 0, 1
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	shard := &s.bucketShards[(rating-s.minRating)%bucketShardCount]
+	shard.Lock()
+	bucket := s.sortedBucket(s.loadTable(), rating-s.minRating)
+	total := len(bucket)
+	page = clampPage(page, calcTotalPages(total, limit))
+	offset := (page - 1) * limit
+	var ids []int
+	if offset < total {
+		ids = append(ids, bucket[offset:min(offset+limit, total)]...)
+	}
+	shard.Unlock()
+
+	table := s.loadTable()
+	rank := s.rank(rating)
+	results := make([]LeaderboardEntry, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, LeaderboardEntry{Rank: rank, Username: table.users[id].Username, Rating: rating})
+	}
+	return results, total, page
+}
+
+// RemoveUser deletes a user from the rating buckets and the username index.
+// The ID's slot in the per-user columns is tombstoned rather than compacted,
+// so no other user's ID or bucketIndex entry moves. The name is free for
+// AddUser again at once; the user leaves leaderboard pages on the next
+// refresh.
+func (s *Store) RemoveUser(username string) bool {
+	s.lockAllBuckets()
+	defer s.unlockAllBuckets()
+
+	current := s.loadTable()
+	id, ok := current.findID(username)
+	if !ok {
+		return false
+	}
+	lower := current.usernameLower[id]
+	pos := sort.Search(len(current.usernameIndex), func(i int) bool {
+		return current.usernameIndex[i].UsernameLower >= lower
+	})
+	for current.usernameIndex[pos].ID != id {
+		pos++
+	}
+	index := make([]UsernameIndex, 0, len(current.usernameIndex)-1)
+	index = append(index, current.usernameIndex[:pos]...)
+	index = append(index, current.usernameIndex[pos+1:]...)
+
+	ratingIdx := int(atomic.LoadInt32(&current.ratings[id])) - s.minRating
+	s.removeFromBucket(id, ratingIdx)
+	s.dirtyBuckets[ratingIdx] = true
+	s.removed[id] = true
+	s.snapshotDirty.Store(true)
+	s.table.Store(&userTable{
+		users:         current.users,
+		ratings:       current.ratings,
+		peakRatings:   current.peakRatings,
+		usernameLower: current.usernameLower,
+		usernameIndex: index,
+	})
+	s.addCount(ratingIdx, -1)
+	s.lastUpdate.Store(time.Now())
+	return true
+}
+
+// removeFromBucket drops id from its rating bucket by moving the bucket's
+// last ID into its slot. The caller must hold the bucket's shard.
+func (s *Store) removeFromBucket(id int, ratingIdx int) {
+	bucket := s.ratingBuckets[ratingIdx]
+	pos := s.bucketIndex[id]
+	lastID := bucket[len(bucket)-1]
+	bucket[pos] = lastID
+	s.bucketIndex[lastID] = pos
+	s.ratingBuckets[ratingIdx] = bucket[:len(bucket)-1]
+}
+
+// PreviewRating reports the entry a user would have after moving to rating,
+// without touching the store. Mutation endpoints use it to serve dry runs,
+// so it fails the same way SetRatingByUsername would.
+func (s *Store) PreviewRating(username string, rating int) (LeaderboardEntry, error) {
+	table := s.loadTable()
+	id, ok := table.findID(username)
+	if !ok {
+		return LeaderboardEntry{}, &UsersNotFoundError{Usernames: []string{username}}
+	}
+	rating, err := s.checkRating(rating)
+	if err != nil {
+		return LeaderboardEntry{}, err
+	}
+	oldRating := int(atomic.LoadInt32(&table.ratings[id]))
+	rank := s.rank(rating)
+	if s.ranksAhead(oldRating, rating) {
+		rank--
+	}
+	return LeaderboardEntry{
+		Rank:     rank,
+		Username: table.users[id].Username,
+		Rating:   rating,
+	}, nil
+}
+
+// LookupUser resolves a username case-insensitively and returns the user's
+// entry as served by the current snapshot, plus the fraction of users
+// ranked strictly behind them. Users added since the snapshot was built get
+// their live entry.
+func (s *Store) LookupUser(username string) (LeaderboardEntry, float64, bool) {
+	table := s.loadTable()
+	id, ok := table.findID(username)
+	if !ok {
+		return LeaderboardEntry{}, 0, false
+	}
+	entry := s.snapshotEntry(table, s.currentSnapshot(), id)
+	return entry, s.percentile(entry.Rating), true
+}
+
+// Compare returns both users' live entries and how b stands relative to a:
+// a positive RatingDiff means b is rated higher, a positive RankDiff that b
+// is ranked further down. Unknown names are reported together in a
+// *UsersNotFoundError.
+func (s *Store) Compare(a, b string) (CompareResult, error) {
+	table := s.loadTable()
+	idA, okA := table.findID(a)
+	idB, okB := table.findID(b)
+	if !okA || !okB {
+		var missing []string
+		if !okA {
+			missing = append(missing, a)
+		}
+		if !okB {
+			missing = append(missing, b)
+		}
+		return CompareResult{}, &UsersNotFoundError{Usernames: missing}
+	}
+	entryA, entryB := s.liveEntry(table, idA), s.liveEntry(table, idB)
+	return CompareResult{
+		A:          entryA,
+		B:          entryB,
+		RatingDiff: entryB.Rating - entryA.Rating,
+		RankDiff:   entryB.Rank - entryA.Rank,
+	}, nil
+}
+
+// RanksFor looks up each username's live rank and rating, in input order.
+// Unknown names come back with Found unset and the name as given.
+func (s *Store) RanksFor(usernames []string) []UserRank {
+	table := s.loadTable()
+	results := make([]UserRank, 0, len(usernames))
+	for _, username := range usernames {
+		id, ok := table.findID(username)
+		if !ok {
+			results = append(results, UserRank{Username: username})
+			continue
+		}
+		entry := s.liveEntry(table, id)
+		results = append(results, UserRank{Username: entry.Username, Rank: entry.Rank, Rating: entry.Rating, Found: true})
+	}
+	return results
+}
+
+// Percentile returns the user's live rating and the fraction of users
+// ranked strictly behind them, from 0 for the last place up to just under
+// 1 for a sole leader.
+func (s *Store) Percentile(username string) (UserPercentile, bool) {
+	table := s.loadTable()
+	id, ok := table.findID(username)
+	if !ok {
+		return UserPercentile{}, false
+	}
+	rating := int(atomic.LoadInt32(&table.ratings[id]))
+	return UserPercentile{
+		Username:   table.users[id].Username,
+		Rating:     rating,
+		Percentile: s.percentile(rating),
+	}, true
+}
+
+// FillPercentiles sets Percentile on each entry from its rating, for
+// include_percentile=1.
+func (s *Store) FillPercentiles(entries []LeaderboardEntry) {
+	values := make([]float64, len(entries))
+	for i := range entries {
+		values[i] = s.percentile(entries[i].Rating)
+		entries[i].Percentile = &values[i]
+	}
+}
+
+func (s *Store) percentile(rating int) float64 {
+	total := s.ratingTree.prefix(len(s.ratingCounts) - 1)
+	if total == 0 {
+		return 0
+	}
+	ratingIdx := s.clampRating(rating) - s.minRating
+	behind := s.ratingTree.prefix(ratingIdx - 1)
+	if s.ascending {
+		behind = total - s.ratingTree.prefix(ratingIdx)
+	}
+	return float64(behind) / float64(total)
+}
+
+func (s *Store) liveEntry(table *userTable, id int) LeaderboardEntry {
+	rating := int(atomic.LoadInt32(&table.ratings[id]))
+	return LeaderboardEntry{
+		Rank:     s.rank(rating),
+		Username: table.users[id].Username,
+		Rating:   rating,
+	}
+}
+
+// snapshotEntry is the user's entry as of snap, read from the ranks the
+// snapshot precomputed, so search agrees with the leaderboard pages and
+// honors the ranking mode. Users added since snap was built fall back to
+// their live entry.
+func (s *Store) snapshotEntry(table *userTable, snap *snapshot, id int) LeaderboardEntry {
+	entry, ok := s.entryAt(snap, snap.position(id))
+	if !ok {
+		return s.liveEntry(table, id)
+	}
+	return entry
+}
+
+// updateUserRating moves id between rating buckets holding only the two
+// buckets' shards. The old rating is read before locking, so it is checked
+// again under the locks and the move retried if another update got there
+// first.
+func (s *Store) updateUserRating(id int, newRating int) {
+	newBucketIdx := newRating - s.minRating
+	for {
+		oldRating := int(atomic.LoadInt32(&s.loadTable().ratings[id]))
+		if oldRating == newRating {
+			return
+		}
+		oldBucketIdx := oldRating - s.minRating
+
+		first, second := s.lockBucketPair(oldBucketIdx, newBucketIdx)
+		table := s.loadTable()
+		if int(atomic.LoadInt32(&table.ratings[id])) != oldRating {
+			s.unlockBucketPair(first, second)
+			continue
+		}
+		if !s.removed[id] {
+			s.moveUser(table, id, oldRating, newRating)
+		}
+		s.unlockBucketPair(first, second)
+		return
+	}
+}
+
+// moveUser does the bucket move for updateUserRating, which holds the
+// shards of both buckets.
+func (s *Store) moveUser(table *userTable, id int, oldRating int, newRating int) {
+	oldBucketIdx := oldRating - s.minRating
+	newBucketIdx := newRating - s.minRating
+
+	s.removeFromBucket(id, oldBucketIdx)
+	newBucket := s.ratingBuckets[newBucketIdx]
+	s.bucketIndex[id] = len(newBucket)
+	newBucket = append(newBucket, id)
+	s.ratingBuckets[newBucketIdx] = newBucket
+	s.dirtyBuckets[oldBucketIdx] = true
+	s.dirtyBuckets[newBucketIdx] = true
+
+	s.addCount(oldBucketIdx, -1)
+	s.addCount(newBucketIdx, 1)
+	atomic.AddUint64(&s.updatesApplied, 1)
+	if int32(newRating) > atomic.LoadInt32(&table.peakRatings[id]) {
+		atomic.StoreInt32(&table.peakRatings[id], int32(newRating))
+	}
+	atomic.StoreInt32(&table.ratings[id], int32(newRating))
+	s.moves.record(id, oldRating, newRating)
+	s.watches.observe(table.users[id].Username, oldRating, newRating)
+	s.snapshotDirty.Store(true)
+}
+
+// lockBucketPair locks the shards of two buckets, lower shard first so
+// concurrent moves in opposite directions cannot deadlock. It returns the
+// shard numbers for unlockBucketPair.
+func (s *Store) lockBucketPair(a int, b int) (int, int) {
+	first, second := a%bucketShardCount, b%bucketShardCount
+	if first > second {
+		first, second = second, first
+	}
+	s.bucketShards[first].Lock()
+	if second != first {
+		s.bucketShards[second].Lock()
+	}
+	return first, second
+}
+
+func (s *Store) unlockBucketPair(first int, second int) {
+	if second != first {
+		s.bucketShards[second].Unlock()
+	}
+	s.bucketShards[first].Unlock()
+}
+
+func (s *Store) lockAllBuckets() {
+	for i := range s.bucketShards {
+		s.bucketShards[i].Lock()
+	}
+}
+
+func (s *Store) unlockAllBuckets() {
+	for i := len(s.bucketShards) - 1; i >= 0; i-- {
+		s.bucketShards[i].Unlock()
+	}
+}
+
+// SetRatingByUsername moves a user to rating, clamped to the valid range or
+// rejected outside it under SetStrictRatings, and returns their live entry.
+// An unknown user is a *UsersNotFoundError. Leaderboard pages pick the
+// change up on the next snapshot refresh.
+func (s *Store) SetRatingByUsername(username string, rating int) (LeaderboardEntry, error) {
+	id, ok := s.findUserID(username)
+	if !ok {
+		return LeaderboardEntry{}, &UsersNotFoundError{Usernames: []string{username}}
+	}
+	rating, err := s.checkRating(rating)
+	if err != nil {
+		return LeaderboardEntry{}, err
+	}
+	s.updateUserRating(id, rating)
+	s.lastUpdate.Store(time.Now())
+	return s.liveEntry(s.loadTable(), id), nil
+}
+
+// SetRatings applies a batch of rating changes in order, so a later entry
+// for the same user wins. Each user moves as in SetRatingByUsername, but
+// the last-update time is bumped once, after every move. An unknown user
+// or, in strict mode, an out-of-range rating fails only its own entry,
+// which the matching result reports.
+func (s *Store) SetRatings(batch []RatingChange) []SetResult {
+	results := make([]SetResult, len(batch))
+	applied := false
+	ids := make([]int, len(batch))
+	for i, change := range batch {
+		result := SetResult{Username: change.Username}
+		id, ok := s.findUserID(change.Username)
+		ids[i] = -1
+		if !ok {
+			results[i] = result
+			continue
+		}
+		result.Found = true
+		rating, err := s.checkRating(change.Rating)
+		if err != nil {
+			result.Error = err.Error()
+			results[i] = result
+			continue
+		}
+		result.Clamped = rating != change.Rating
+		if int(atomic.LoadInt32(&s.loadTable().ratings[id])) != rating {
+			s.updateUserRating(id, rating)
+			result.Applied = true
+			applied = true
+		}
+		ids[i] = id
+		results[i] = result
+	}
+	if applied {
+		s.lastUpdate.Store(time.Now())
+	}
+	// Ranks are read once every move is done, so they agree with each
+	// other rather than with the board part-way through the batch.
+	table := s.loadTable()
+	for i, id := range ids {
+		if id < 0 {
+			continue
+		}
+		entry := s.liveEntry(table, id)
+		results[i].Username = entry.Username
+		results[i].Rank = entry.Rank
+		results[i].Rating = entry.Rating
+	}
+	return results
+}
+
+// PreviewRatings reports what SetRatings would do with batch without
+// touching the store. Each change is previewed on its own against the
+// current board, as PreviewRating does, so a result's Rank and Rating
+// describe that change alone, and Applied reports whether it would move the
+// user.
+func (s *Store) PreviewRatings(batch []RatingChange) []SetResult {
+	results := make([]SetResult, len(batch))
+	table := s.loadTable()
+	for i, change := range batch {
+		result := SetResult{Username: change.Username}
+		id, ok := table.findID(change.Username)
+		if !ok {
+			results[i] = result
+			continue
+		}
+		result.Found = true
+		entry, err := s.PreviewRating(change.Username, change.Rating)
+		if err != nil {
+			result.Error = err.Error()
+			results[i] = result
+			continue
+		}
+		result.Clamped = entry.Rating != change.Rating
+		result.Applied = int(atomic.LoadInt32(&table.ratings[id])) != entry.Rating
+		result.Username = entry.Username
+		result.Rank = entry.Rank
+		result.Rating = entry.Rating
+		results[i] = result
+	}
+	return results
+}
+
+// SetStrictRatings chooses between clamping out-of-range ratings given to
+// AddUser, SetRatingByUsername and PreviewRating, the default, and
+// rejecting them with ErrRatingOutOfRange. Random updates always clamp.
+func (s *Store) SetStrictRatings(strict bool) {
+	s.strictRatings.Store(strict)
+}
+
+// checkRating clamps rating to the bounds, or in strict mode rejects it.
+func (s *Store) checkRating(rating int) (int, error) {
+	if s.strictRatings.Load() && (rating < s.minRating || rating > s.maxRating) {
+		return 0, fmt.Errorf("%w: %d is outside %d-%d", ErrRatingOutOfRange, rating, s.minRating, s.maxRating)
+	}
+	return s.clampRating(rating), nil
+}
+
+func (s *Store) UpdatesApplied() uint64 {
+	return atomic.LoadUint64(&s.updatesApplied)
+}
+
+func (s *Store) SnapshotsBuilt() uint64 {
+	return atomic.LoadUint64(&s.snapshotSeq)
+}
+
+func (s *Store) PeakRating(username string) (UserPeak, bool) {
+	table := s.loadTable()
+	id, ok := table.findID(username)
+	if !ok {
+		return UserPeak{}, false
+	}
+	return UserPeak{
+		Username:   table.users[id].Username,
+		Rating:     int(atomic.LoadInt32(&table.ratings[id])),
+		PeakRating: int(atomic.LoadInt32(&table.peakRatings[id])),
+	}, true
+}
+
+// StartRandomUpdates applies updatesPerTick random rating changes of at
+// most deltaMax either way every tickMs until ctx is done. The users and
+// deltas are drawn from newRand(seed), so a fixed seed replays the same
+// sequence of updates.
+func (s *Store) StartRandomUpdates(ctx context.Context, updatesPerTick int, tickMs int, deltaMax int, seed int64) {
+	if updatesPerTick <= 0 || tickMs <= 0 || deltaMax <= 0 {
+		return
+	}
+
+	source := newRand(seed)
+	ticker := time.NewTicker(time.Duration(tickMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.updatesPaused.Load() {
+				s.randomTick(source, updatesPerTick, deltaMax)
+			}
+		}
+	}
+}
+
+// randomTick applies one tick of StartRandomUpdates: updatesPerTick changes
+// of at most deltaMax, drawn from source.
+func (s *Store) randomTick(source *rand.Rand, updatesPerTick int, deltaMax int) {
+	table := s.loadTable()
+	if len(table.users) == 0 {
+		return
+	}
+	type update struct {
+		id    int
+		delta int
+	}
+	batch := make([]update, updatesPerTick)
+	for i := 0; i < updatesPerTick; i++ {
+		batch[i] = update{
+			id:    source.Intn(len(table.users)),
+			delta: source.Intn(2*deltaMax+1) - deltaMax,
+		}
+	}
+
+	start := time.Now()
+	applied := 0
+	for _, item := range batch {
+		oldRating := int(atomic.LoadInt32(&table.ratings[item.id]))
+		newRating := s.clampRating(oldRating + item.delta)
+		if newRating != oldRating {
+			s.updateUserRating(item.id, newRating)
+			applied++
+		}
+	}
+	if applied > 0 {
+		now := time.Now()
+		s.updateTimes.record(now.Sub(start) / time.Duration(applied))
+		s.updateRate.AddN(now, uint64(applied))
+		s.lastUpdate.Store(now)
+	}
+}
+
+// SetUpdatesPaused stops or restarts the random rating churn. Ticks that
+// arrive while paused are skipped rather than queued.
+func (s *Store) SetUpdatesPaused(paused bool) {
+	s.updatesPaused.Store(paused)
+}
+
+func (s *Store) UpdatesPaused() bool {
+	return s.updatesPaused.Load()
+}
+
+// validateUsername holds the signup rules shared by /validate-username and
+// user creation: 3-32 characters of letters, digits, '_', '.' or '-'.
+func validateUsername(username string) error {
+	length := utf8.RuneCountInString(username)
+	if length < minUsernameLength || length > maxUsernameLength {
+		return fmt.Errorf("username must be %d-%d characters", minUsernameLength, maxUsernameLength)
+	}
+	for _, r := range username {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-' {
+			continue
+		}
+		return fmt.Errorf("username may only contain letters, digits, '_', '.' and '-'")
+	}
+	return nil
+}
+
+// normalizeUsername is the key usernames are indexed, matched and compared
+// by: lower case with combining marks stripped, so "José" and "jose" are the
+// same name. ASCII names skip the Unicode work.
+func normalizeUsername(username string) string {
+	ascii := true
+	for i := 0; i < len(username); i++ {
+		if username[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return strings.ToLower(username)
+	}
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), username)
+	if err != nil {
+		folded = username
+	}
+	return strings.ToLower(folded)
+}
+
+func (s *Store) clampRating(value int) int {
+	if value < s.minRating {
+		return s.minRating
+	}
+	if value > s.maxRating {
+		return s.maxRating
+	}
+	return value
+}
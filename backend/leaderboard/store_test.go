@@ -0,0 +1,681 @@
+package leaderboard
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// randomSeeds returns count users with ratings drawn from [low, high], so
+// small ranges give plenty of ties.
+func randomSeeds(count int, low, high int, seed int64) []SeedUser {
+	source := rand.New(rand.NewSource(seed))
+	seeds := make([]SeedUser, count)
+	for i := range seeds {
+		seeds[i] = SeedUser{Username: fmt.Sprintf("player_%05d", i), Rating: low + source.Intn(high-low+1)}
+	}
+	return seeds
+}
+
+// applyRandomUpdates moves n random users to random ratings in the store's
+// range.
+func applyRandomUpdates(s *Store, n int, seed int64) {
+	source := rand.New(rand.NewSource(seed))
+	count := len(s.loadTable().users)
+	for i := 0; i < n; i++ {
+		s.updateUserRating(source.Intn(count), s.minRating+source.Intn(s.maxRating-s.minRating+1))
+	}
+}
+
+// bruteForceRanks counts, for a rating, the users ranked strictly ahead of
+// it and the distinct ratings they hold.
+func bruteForceRanks(s *Store, rating int) (int, int) {
+	table := s.loadTable()
+	ahead := 0
+	distinct := map[int32]bool{}
+	for id := range table.users {
+		if s.removed[id] {
+			continue
+		}
+		other := atomic.LoadInt32(&table.ratings[id])
+		if (s.ascending && int(other) < rating) || (!s.ascending && int(other) > rating) {
+			ahead++
+			distinct[other] = true
+		}
+	}
+	return ahead + 1, len(distinct) + 1
+}
+
+// countingRank is rank as it was before the Fenwick tree: a walk over every
+// rating bucket ahead of rating.
+func countingRank(s *Store, rating int) int {
+	ratingIdx := s.clampRating(rating) - s.minRating
+	ahead := int64(0)
+	if s.ascending {
+		for idx := 0; idx < ratingIdx; idx++ {
+			ahead += atomic.LoadInt64(&s.ratingCounts[idx])
+		}
+	} else {
+		for idx := ratingIdx + 1; idx < len(s.ratingCounts); idx++ {
+			ahead += atomic.LoadInt64(&s.ratingCounts[idx])
+		}
+	}
+	return int(ahead) + 1
+}
+
+func TestRankMatchesBruteForce(t *testing.T) {
+	tests := []struct {
+		name      string
+		seeds     []SeedUser
+		direction RankDirection
+		updates   int
+	}{
+		{"empty", nil, RankDescending, 0},
+		{"single user", []SeedUser{{Username: "solo", Rating: 150}}, RankDescending, 0},
+		{"all tied", randomSeeds(50, 200, 200, 1), RankDescending, 0},
+		{"bounds held", []SeedUser{{Username: "low", Rating: 100}, {Username: "high", Rating: 300}, {Username: "mid", Rating: 200}}, RankDescending, 0},
+		{"many ties", randomSeeds(500, 100, 130, 2), RankDescending, 0},
+		{"after updates", randomSeeds(500, 100, 300, 3), RankDescending, 2000},
+		{"ascending", randomSeeds(500, 100, 300, 4), RankAscending, 0},
+		{"ascending after updates", randomSeeds(500, 100, 300, 5), RankAscending, 2000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewStoreWithBounds(tt.seeds, 100, 300)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetRankDirection(tt.direction); err != nil {
+				t.Fatal(err)
+			}
+			applyRandomUpdates(s, tt.updates, 42)
+			// Ratings outside the bounds clamp, so check a little past them.
+			for rating := 90; rating <= 310; rating++ {
+				wantRank, wantDense := bruteForceRanks(s, s.clampRating(rating))
+				if got := s.rank(rating); got != wantRank {
+					t.Fatalf("rank(%d) = %d, want %d", rating, got, wantRank)
+				}
+				if got := countingRank(s, rating); got != wantRank {
+					t.Fatalf("counting rank(%d) = %d, want %d", rating, got, wantRank)
+				}
+				if got := s.DenseRank(rating); got != wantDense {
+					t.Fatalf("DenseRank(%d) = %d, want %d", rating, got, wantDense)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := map[string]string{
+		"José":         "jose",
+		"jose":         "jose",
+		"JOSÉ":         "jose",
+		"Müller":       "muller",
+		"muller":       "muller",
+		"Mu\u0308ller": "muller",
+		"Player_01":    "player_01",
+		"zoë.k-9":      "zoe.k-9",
+	}
+	for username, want := range tests {
+		if got := normalizeUsername(username); got != want {
+			t.Errorf("normalizeUsername(%q) = %q, want %q", username, got, want)
+		}
+	}
+
+	s, err := NewStore([]SeedUser{{Username: "José", Rating: 2000}, {Username: "Müller", Rating: 1900}, {Username: "mull", Rating: 1800}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+	for query, want := range map[string]string{"jose": "José", "JOSE": "José", "muller": "Müller", "müller": "Müller"} {
+		entry, _, ok := s.LookupUser(query)
+		if !ok || entry.Username != want {
+			t.Errorf("LookupUser(%q) = %q, %t; want %q", query, entry.Username, ok, want)
+		}
+		results, _, _, _ := s.SearchPage(query, 1, 10)
+		if len(results) != 1 || results[0].Username != want {
+			t.Errorf("SearchPage(%q) = %v, want only %q", query, results, want)
+		}
+	}
+	if results, _, _, _ := s.SearchPage("mul", 1, 10); len(results) != 2 {
+		t.Errorf("ASCII prefix mul matched %v, want mull and Müller", results)
+	}
+	if _, err := s.AddUser("jose", 1500); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("adding jose next to José: %v, want ErrUsernameTaken", err)
+	}
+}
+
+func TestStatsMedian(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratings []int
+		median  float64
+		mean    float64
+	}{
+		{"empty", nil, 0, 0},
+		{"one user", []int{250}, 250, 250},
+		{"odd count", []int{300, 100, 200}, 200, 200},
+		{"odd count with ties", []int{100, 100, 400, 400, 400}, 400, 280},
+		{"even count", []int{100, 200, 300, 400}, 250, 250},
+		{"even count split across ties", []int{100, 100, 101, 101}, 100.5, 100.5},
+		{"even count inside one tie", []int{100, 300, 300, 400}, 300, 275},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seeds := make([]SeedUser, len(tt.ratings))
+			for i, rating := range tt.ratings {
+				seeds[i] = SeedUser{Username: fmt.Sprintf("user_%d", i), Rating: rating}
+			}
+			s, err := NewStoreWithBounds(seeds, 100, 400)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stats := s.Stats()
+			if stats.TotalUsers != int64(len(tt.ratings)) || stats.MedianRating != tt.median || stats.MeanRating != tt.mean {
+				t.Fatalf("total %d, median %g, mean %g; want %d, %g, %g", stats.TotalUsers, stats.MedianRating, stats.MeanRating, len(tt.ratings), tt.median, tt.mean)
+			}
+			if len(tt.ratings) > 0 && (stats.MinRating != slices.Min(tt.ratings) || stats.MaxRating != slices.Max(tt.ratings)) {
+				t.Fatalf("min %d, max %d; want %d, %d", stats.MinRating, stats.MaxRating, slices.Min(tt.ratings), slices.Max(tt.ratings))
+			}
+		})
+	}
+}
+
+func benchmarkStore(b *testing.B, users int) *Store {
+	b.Helper()
+	s, err := NewStore(randomSeeds(users, defaultMinRating, defaultMaxRating, 1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+func BenchmarkRank(b *testing.B) {
+	s := benchmarkStore(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.rank(defaultMinRating + i%(defaultMaxRating-defaultMinRating+1))
+	}
+}
+
+// BenchmarkRankCounting is the bucket walk rank used before the Fenwick
+// tree, for comparison with BenchmarkRank.
+func BenchmarkRankCounting(b *testing.B) {
+	s := benchmarkStore(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		countingRank(s, defaultMinRating+i%(defaultMaxRating-defaultMinRating+1))
+	}
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	s := benchmarkStore(b, 100000)
+	source := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.updateUserRating(source.Intn(100000), defaultMinRating+source.Intn(defaultMaxRating-defaultMinRating+1))
+	}
+}
+
+func TestConcurrentUpdatesKeepStoreConsistent(t *testing.T) {
+	s, err := NewStoreWithBounds(randomSeeds(2000, 100, 400, 1), 100, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RefreshSnapshot()
+
+	var wg sync.WaitGroup
+	run := func(fn func(worker int, source *rand.Rand)) {
+		for worker := 0; worker < 4; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fn(worker, rand.New(rand.NewSource(int64(worker))))
+			}()
+		}
+	}
+	run(func(_ int, source *rand.Rand) {
+		for i := 0; i < 2000; i++ {
+			s.updateUserRating(source.Intn(2000), 100+source.Intn(301))
+		}
+	})
+	run(func(worker int, source *rand.Rand) {
+		for i := 0; i < 50; i++ {
+			if _, err := s.AddUser(fmt.Sprintf("joiner_%d_%03d", worker, i), 100+source.Intn(301)); err != nil {
+				t.Error(err)
+			}
+			s.RemoveUser(fmt.Sprintf("player_%05d", source.Intn(2000)))
+		}
+	})
+	run(func(_ int, source *rand.Rand) {
+		for i := 0; i < 50; i++ {
+			s.RefreshSnapshot()
+			s.LeaderboardPage(1+source.Intn(10), 50)
+			s.SearchPage("player_0", 1, 20)
+			s.LookupUser(fmt.Sprintf("player_%05d", source.Intn(2000)))
+		}
+	})
+	wg.Wait()
+
+	s.RefreshSnapshot()
+	compareSnapshots(t, s.currentSnapshot(), referenceSnapshot(s))
+	if got, want := int(s.ratingTree.prefix(len(s.ratingCounts)-1)), s.UserCount(); got != want {
+		t.Fatalf("rating tree counts %d users, want %d", got, want)
+	}
+	for rating := 100; rating <= 400; rating++ {
+		if want, _ := bruteForceRanks(s, rating); s.rank(rating) != want {
+			t.Fatalf("rank(%d) = %d, want %d", rating, s.rank(rating), want)
+		}
+	}
+}
+
+func TestPeakRatingTracksMaxUnderChurn(t *testing.T) {
+	seeds := randomSeeds(200, 100, 400, 1)
+	s, err := NewStoreWithBounds(seeds, 100, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each worker records the highest rating it gave each user; the peak
+	// must be the highest of those and the seed rating.
+	const workers = 4
+	highest := make([][]int, workers)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		highest[worker] = make([]int, len(seeds))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			source := rand.New(rand.NewSource(int64(worker)))
+			for i := 0; i < 20000; i++ {
+				id, rating := source.Intn(len(seeds)), 100+source.Intn(301)
+				s.updateUserRating(id, rating)
+				highest[worker][id] = max(highest[worker][id], rating)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for id, seed := range seeds {
+		want := seed.Rating
+		for worker := range highest {
+			want = max(want, highest[worker][id])
+		}
+		peak, ok := s.PeakRating(seed.Username)
+		if !ok || peak.PeakRating != want {
+			t.Fatalf("%s: peak %d, want %d", seed.Username, peak.PeakRating, want)
+		}
+		if peak.Rating > peak.PeakRating {
+			t.Fatalf("%s: rating %d is above peak %d", seed.Username, peak.Rating, peak.PeakRating)
+		}
+	}
+}
+
+func TestMoveUserKeepsBucketMembership(t *testing.T) {
+	s, err := NewStoreWithBounds(randomSeeds(300, 100, 130, 1), 100, 130)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := rand.New(rand.NewSource(2))
+	for round := 0; round < 20; round++ {
+		applyRandomUpdates(s, 200, int64(round))
+		if _, err := s.AddUser(fmt.Sprintf("joiner_%02d", round), 100+source.Intn(31)); err != nil {
+			t.Fatal(err)
+		}
+		s.RemoveUser(fmt.Sprintf("player_%05d", source.Intn(300)))
+
+		table := s.loadTable()
+		seen := make(map[int]bool)
+		for idx, bucket := range s.ratingBuckets {
+			if int64(len(bucket)) != atomic.LoadInt64(&s.ratingCounts[idx]) {
+				t.Fatalf("round %d: bucket %d holds %d users but counts %d", round, s.minRating+idx, len(bucket), s.ratingCounts[idx])
+			}
+			for pos, id := range bucket {
+				switch {
+				case seen[id]:
+					t.Fatalf("round %d: user %d is in more than one bucket slot", round, id)
+				case s.removed[id]:
+					t.Fatalf("round %d: removed user %d is still in bucket %d", round, id, s.minRating+idx)
+				case int(table.ratings[id]) != s.minRating+idx:
+					t.Fatalf("round %d: user %d rated %d sits in bucket %d", round, id, table.ratings[id], s.minRating+idx)
+				case s.bucketIndex[id] != pos:
+					t.Fatalf("round %d: user %d is at slot %d but bucketIndex says %d", round, id, pos, s.bucketIndex[id])
+				}
+				seen[id] = true
+			}
+		}
+		if len(seen) != s.UserCount() {
+			t.Fatalf("round %d: buckets hold %d users, want %d", round, len(seen), s.UserCount())
+		}
+	}
+}
+
+// BenchmarkConcurrentUpdates runs rating updates from every P. The global
+// case serializes them behind one mutex, as the single bucket lock did
+// before the bucket locks were sharded.
+func BenchmarkConcurrentUpdates(b *testing.B) {
+	for _, global := range []bool{false, true} {
+		name := "sharded"
+		if global {
+			name = "global"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := benchmarkStore(b, 100000)
+			var mu sync.Mutex
+			var seed atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				source := rand.New(rand.NewSource(seed.Add(1)))
+				for pb.Next() {
+					id := source.Intn(100000)
+					rating := defaultMinRating + source.Intn(defaultMaxRating-defaultMinRating+1)
+					if global {
+						mu.Lock()
+						s.updateUserRating(id, rating)
+						mu.Unlock()
+					} else {
+						s.updateUserRating(id, rating)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestNewStoreRejectsDuplicateSeeds(t *testing.T) {
+	tests := []struct {
+		name  string
+		seeds []SeedUser
+		want  string
+	}{
+		{"exact", []SeedUser{{Username: "ann", Rating: 1500}, {Username: "bob", Rating: 1400}, {Username: "ann", Rating: 1300}}, `seed 2 "ann": username is already taken by seed 0 "ann"`},
+		{"case", []SeedUser{{Username: "Ann", Rating: 1500}, {Username: "ANN", Rating: 1400}}, `seed 1 "ANN": username is already taken by seed 0 "Ann"`},
+		{"diacritics", []SeedUser{{Username: "bob", Rating: 1500}, {Username: "José", Rating: 1400}, {Username: "jose", Rating: 1300}}, `seed 2 "jose": username is already taken by seed 1 "José"`},
+		{"first of several", []SeedUser{{Username: "a", Rating: 1500}, {Username: "b", Rating: 1500}, {Username: "B", Rating: 1500}, {Username: "A", Rating: 1500}}, `seed 2 "B": username is already taken by seed 1 "b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewStore(tt.seeds)
+			if s != nil || !errors.Is(err, ErrUsernameTaken) {
+				t.Fatalf("got store %v, error %v; want ErrUsernameTaken", s != nil, err)
+			}
+			if err.Error() != tt.want {
+				t.Fatalf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := NewStore([]SeedUser{{Username: "ann", Rating: 1500}, {Username: "anna", Rating: 1500}}); err != nil {
+		t.Fatalf("distinct usernames: %v", err)
+	}
+}
+
+func TestPercentileTopAndBottom(t *testing.T) {
+	s, err := NewStore(testSeeds(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		username string
+		want     float64
+	}{
+		{"user_000", 0.99},
+		{"user_050", 0.49},
+		{"user_099", 0},
+	}
+	for _, tt := range tests {
+		got, ok := s.Percentile(tt.username)
+		if !ok || math.Abs(got.Percentile-tt.want) > 1e-9 {
+			t.Errorf("%s: percentile %v, want %v", tt.username, got.Percentile, tt.want)
+		}
+	}
+	if _, ok := s.Percentile("nobody"); ok {
+		t.Error("unknown user has a percentile")
+	}
+
+	// Users tied at the top beat everyone but each other.
+	tied, err := NewStore([]SeedUser{{Username: "a", Rating: 3000}, {Username: "b", Rating: 3000}, {Username: "c", Rating: 1000}, {Username: "d", Rating: 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for username, want := range map[string]float64{"a": 0.5, "b": 0.5, "c": 0, "d": 0} {
+		if got, _ := tied.Percentile(username); got.Percentile != want {
+			t.Errorf("tied %s: percentile %v, want %v", username, got.Percentile, want)
+		}
+	}
+	alone, err := NewStore([]SeedUser{{Username: "solo", Rating: 3000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := alone.Percentile("solo"); got.Percentile != 0 {
+		t.Errorf("sole user: percentile %v, want 0", got.Percentile)
+	}
+}
+
+func TestRandomTickStaysInDeltaBand(t *testing.T) {
+	const deltaMax = 3
+	s, err := NewStore(randomSeeds(20, 2000, 3000, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := newRand(42)
+	ratings := func() []int {
+		table := s.loadTable()
+		out := make([]int, len(table.ratings))
+		for id := range out {
+			out[id] = int(table.ratings[id])
+		}
+		return out
+	}
+
+	before := ratings()
+	seen := make(map[int]bool)
+	for tick := 0; tick < 500; tick++ {
+		s.randomTick(source, 1, deltaMax)
+		after := ratings()
+		moved := 0
+		for id := range after {
+			delta := after[id] - before[id]
+			if delta == 0 {
+				continue
+			}
+			moved++
+			seen[delta] = true
+			if delta < -deltaMax || delta > deltaMax {
+				t.Fatalf("tick %d: user %d moved %d, outside ±%d", tick, id, delta, deltaMax)
+			}
+		}
+		if moved > 1 {
+			t.Fatalf("tick %d: %d users moved with one update per tick", tick, moved)
+		}
+		before = after
+	}
+	for delta := -deltaMax; delta <= deltaMax; delta++ {
+		if delta != 0 && !seen[delta] {
+			t.Errorf("no tick moved a rating by %d in 500 ticks", delta)
+		}
+	}
+}
+
+// ratingOf returns the user's live rating.
+func ratingOf(s *Store, username string) (int, bool) {
+	id, ok := s.findUserID(username)
+	if !ok {
+		return 0, false
+	}
+	return int(s.loadTable().ratings[id]), true
+}
+
+func TestStrictAndLenientRatings(t *testing.T) {
+	seeds := []SeedUser{{Username: "low", Rating: 50}, {Username: "high", Rating: 9999}, {Username: "floor", Rating: defaultMinRating}, {Username: "ceiling", Rating: defaultMaxRating}}
+	if err := checkSeedRatings(seeds, defaultMinRating, defaultMaxRating); !errors.Is(err, ErrRatingOutOfRange) || !strings.Contains(err.Error(), `seed 0 "low"`) {
+		t.Fatalf("strict seed check: %v, want seed 0 rejected", err)
+	}
+	if err := checkSeedRatings(seeds[2:], defaultMinRating, defaultMaxRating); err != nil {
+		t.Fatalf("strict seed check on the bounds: %v", err)
+	}
+
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			s, err := NewStore(seeds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.SetStrictRatings(strict)
+			// Seeds are clamped whatever the mode; startup checks them first.
+			for username, want := range map[string]int{"low": defaultMinRating, "high": defaultMaxRating} {
+				if got, _ := ratingOf(s, username); got != want {
+					t.Errorf("seed %s rated %d, want %d", username, got, want)
+				}
+			}
+
+			_, err = s.AddUser("newcomer", 99999)
+			if strict {
+				if !errors.Is(err, ErrRatingOutOfRange) || err.Error() != "rating is out of range: 99999 is outside 100-5000" {
+					t.Errorf("AddUser out of range: %v", err)
+				}
+				if _, ok := ratingOf(s, "newcomer"); ok {
+					t.Error("a rejected user was added")
+				}
+			} else if got, _ := ratingOf(s, "newcomer"); err != nil || got != defaultMaxRating {
+				t.Errorf("AddUser out of range: %v, rated %d; want clamped to %d", err, got, defaultMaxRating)
+			}
+
+			_, err = s.SetRatingByUsername("floor", -5)
+			got, _ := ratingOf(s, "floor")
+			if strict && (!errors.Is(err, ErrRatingOutOfRange) || got != defaultMinRating) {
+				t.Errorf("SetRatingByUsername out of range: %v, rated %d", err, got)
+			}
+			if !strict && (err != nil || got != defaultMinRating) {
+				t.Errorf("SetRatingByUsername out of range: %v, rated %d; want clamped", err, got)
+			}
+
+			for _, rating := range []int{defaultMinRating, defaultMaxRating} {
+				if _, err := s.SetRatingByUsername("floor", rating); err != nil {
+					t.Errorf("rating %d on the bound: %v", rating, err)
+				}
+			}
+
+			// Random churn always clamps, even in strict mode.
+			s.randomTick(newRand(1), 200, 10000)
+			table := s.loadTable()
+			for id, rating := range table.ratings {
+				if rating < defaultMinRating || rating > defaultMaxRating {
+					t.Fatalf("random update left %s at %d", table.users[id].Username, rating)
+				}
+			}
+		})
+	}
+}
+
+func TestSetRatingsWithPartiallyInvalidBatch(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			s, err := NewStore(testSeeds(6))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.SetStrictRatings(strict)
+			s.RefreshSnapshot()
+			before := s.LastUpdate()
+
+			results := s.SetRatings([]RatingChange{
+				{Username: "user_005", Rating: 4500},
+				{Username: "ghost", Rating: 2000},
+				{Username: "user_000", Rating: 99999},
+				{Username: "USER_002", Rating: 3980},
+				{Username: "user_004", Rating: 1000},
+				{Username: "user_005", Rating: 4600},
+			})
+			want := []SetResult{
+				{Username: "user_005", Found: true, Applied: true, Rank: 1, Rating: 4600},
+				{Username: "ghost"},
+				{Username: "user_000", Found: true, Clamped: true, Applied: true, Rank: 1, Rating: 5000},
+				{Username: "user_002", Found: true, Rank: 4, Rating: 3980},
+				{Username: "user_004", Found: true, Applied: true, Rank: 6, Rating: 1000},
+				{Username: "user_005", Found: true, Applied: true, Rank: 2, Rating: 4600},
+			}
+			if strict {
+				want[0].Rank = 1
+				want[2] = SetResult{Username: "user_000", Found: true, Error: "rating is out of range: 99999 is outside 100-5000"}
+				want[5].Rank = 1
+			} else {
+				want[0].Rank = 2
+			}
+			if len(results) != len(want) {
+				t.Fatalf("got %d results, want %d", len(results), len(want))
+			}
+			for i := range want {
+				if results[i] != want[i] {
+					t.Errorf("result %d: got %+v, want %+v", i, results[i], want[i])
+				}
+			}
+			if !s.LastUpdate().After(before) {
+				t.Error("LastUpdate was not bumped")
+			}
+
+			s.RefreshSnapshot()
+			var order []string
+			for _, entry := range s.SnapshotView() {
+				order = append(order, fmt.Sprintf("%s@%d", entry.Username, entry.Rating))
+			}
+			wantOrder := []string{"user_000@5000", "user_005@4600", "user_001@3990", "user_002@3980", "user_003@3970", "user_004@1000"}
+			if strict {
+				wantOrder = []string{"user_005@4600", "user_000@4000", "user_001@3990", "user_002@3980", "user_003@3970", "user_004@1000"}
+			}
+			if !slices.Equal(order, wantOrder) {
+				t.Fatalf("snapshot %v, want %v", order, wantOrder)
+			}
+		})
+	}
+
+	s, err := NewStore(testSeeds(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := s.LastUpdate()
+	results := s.SetRatings([]RatingChange{{Username: "ghost", Rating: 2000}, {Username: "user_001", Rating: 3990}})
+	if results[0].Found || results[1].Applied || !s.LastUpdate().Equal(before) {
+		t.Fatalf("a batch with nothing to apply: %+v, LastUpdate moved %v", results, !s.LastUpdate().Equal(before))
+	}
+}
+
+func TestUsersAtRatingPages(t *testing.T) {
+	seeds := []SeedUser{{Username: "top", Rating: 4000}}
+	for _, name := range []string{"rahul_e", "rahul_a", "rahul_d", "rahul_c", "rahul_b"} {
+		seeds = append(seeds, SeedUser{Username: name, Rating: 3900})
+	}
+	s, err := NewStore(seeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rating, page, limit int
+		want                []string
+		total, wantPage     int
+	}{
+		{3900, 1, 2, []string{"rahul_a", "rahul_b"}, 5, 1},
+		{3900, 3, 2, []string{"rahul_e"}, 5, 3},
+		{3900, 9, 2, []string{"rahul_e"}, 5, 3},
+		{3900, 0, 10, []string{"rahul_a", "rahul_b", "rahul_c", "rahul_d", "rahul_e"}, 5, 1},
+		{3000, 2, 10, nil, 0, 2},
+	}
+	for _, tt := range tests {
+		entries, total, page := s.UsersAtRating(tt.rating, tt.page, tt.limit)
+		var names []string
+		for _, entry := range entries {
+			if entry.Rank != 2 || entry.Rating != tt.rating {
+				t.Errorf("rating %d: entry %+v", tt.rating, entry)
+			}
+			names = append(names, entry.Username)
+		}
+		if !slices.Equal(names, tt.want) || total != tt.total || page != tt.wantPage {
+			t.Errorf("rating %d page %d limit %d: %v, total %d, page %d; want %v, %d, %d", tt.rating, tt.page, tt.limit, names, total, page, tt.want, tt.total, tt.wantPage)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package leaderboard
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+type Tier struct {
+	Name      string `json:"name"`
+	MinRating int    `json:"min_rating"`
+	MaxRating int    `json:"max_rating"`
+}
+
+type TierCount struct {
+	Tier
+	Users int64 `json:"users"`
+}
+
+type UserTier struct {
+	Username       string `json:"username"`
+	Rating         int    `json:"rating"`
+	Tier           string `json:"tier"`
+	NextTier       string `json:"next_tier,omitempty"`
+	NextTierRating int    `json:"next_tier_rating,omitempty"`
+	PointsNeeded   int    `json:"points_needed,omitempty"`
+}
+
+var defaultTierNames = []string{"Bronze", "Silver", "Gold", "Platinum", "Diamond"}
+
+// defaultTiers returns the classic thresholds for the default rating range.
+// Other ranges are split into the same five tiers of near-equal width.
+func defaultTiers(low, high int) []Tier {
+	if low == defaultMinRating && high == defaultMaxRating {
+		tiers, _ := parseTiers("Bronze:100,Silver:1000,Gold:2000,Platinum:3000,Diamond:4000", low, high)
+		return tiers
+	}
+	count := len(defaultTierNames)
+	if span := high - low + 1; span < count {
+		count = span
+	}
+	parts := make([]string, count)
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%s:%d", defaultTierNames[i], low+i*(high-low+1)/count)
+	}
+	tiers, _ := parseTiers(strings.Join(parts, ","), low, high)
+	return tiers
+}
+
+// parseTiers reads "Name:minRating" pairs. Each tier runs up to the next
+// tier's minimum; the first must start at low and the last ends at high, so
+// the tiers always cover the whole rating range.
+func parseTiers(raw string, low, high int) ([]Tier, error) {
+	var tiers []Tier
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, rawMin, ok := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("tier %q must be name:min_rating", part)
+		}
+		min, err := strconv.Atoi(strings.TrimSpace(rawMin))
+		if err != nil {
+			return nil, fmt.Errorf("tier %q has invalid min rating", name)
+		}
+		if min < low || min > high {
+			return nil, fmt.Errorf("tier %q min rating %d is outside %d-%d", name, min, low, high)
+		}
+		if len(tiers) > 0 && min <= tiers[len(tiers)-1].MinRating {
+			return nil, fmt.Errorf("tier %q min rating %d must be above %d", name, min, tiers[len(tiers)-1].MinRating)
+		}
+		tiers = append(tiers, Tier{Name: name, MinRating: min})
+	}
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("no tiers configured")
+	}
+	if tiers[0].MinRating != low {
+		return nil, fmt.Errorf("first tier must start at %d", low)
+	}
+	for i := range tiers {
+		if i+1 < len(tiers) {
+			tiers[i].MaxRating = tiers[i+1].MinRating - 1
+		} else {
+			tiers[i].MaxRating = high
+		}
+	}
+	return tiers, nil
+}
+
+func (s *Store) tierIndex(rating int) int {
+	rating = s.clampRating(rating)
+	return sort.Search(len(s.tiers), func(i int) bool {
+		return s.tiers[i].MaxRating >= rating
+	})
+}
+
+// TierOf names the tier rating falls in. Ratings outside the store's range
+// are clamped first, so every rating has a tier.
+func (s *Store) TierOf(rating int) string {
+	return s.tiers[s.tierIndex(rating)].Name
+}
+
+func (s *Store) TierCounts() []TierCount {
+	counts := make([]TierCount, len(s.tiers))
+	for i, tier := range s.tiers {
+		counts[i].Tier = tier
+		counts[i].Users = s.countBetween(tier.MinRating, tier.MaxRating)
+	}
+	return counts
+}
+
+func (s *Store) UserTier(username string) (UserTier, bool) {
+	table := s.loadTable()
+	id, ok := table.findID(username)
+	if !ok {
+		return UserTier{}, false
+	}
+	rating := int(atomic.LoadInt32(&table.ratings[id]))
+	idx := s.tierIndex(rating)
+	result := UserTier{
+		Username: table.users[id].Username,
+		Rating:   rating,
+		Tier:     s.TierOf(rating),
+	}
+	if idx+1 < len(s.tiers) {
+		next := s.tiers[idx+1]
+		result.NextTier = next.Name
+		result.NextTierRating = next.MinRating
+		result.PointsNeeded = next.MinRating - rating
+	}
+	return result, true
+}
@@ -0,0 +1,139 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTierOfBoundaries(t *testing.T) {
+	s, err := NewStore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rating int
+		want   string
+	}{
+		{defaultMinRating, "Bronze"},
+		{999, "Bronze"},
+		{1000, "Silver"},
+		{1999, "Silver"},
+		{2000, "Gold"},
+		{2999, "Gold"},
+		{3000, "Platinum"},
+		{3999, "Platinum"},
+		{4000, "Diamond"},
+		{defaultMaxRating, "Diamond"},
+		{defaultMinRating - 1, "Bronze"},
+		{defaultMaxRating + 1, "Diamond"},
+	}
+	for _, tt := range tests {
+		if got := s.TierOf(tt.rating); got != tt.want {
+			t.Errorf("TierOf(%d) = %q, want %q", tt.rating, got, tt.want)
+		}
+	}
+}
+
+func TestCustomTierBoundaries(t *testing.T) {
+	seeds := []SeedUser{
+		{Username: "floor", Rating: 100},
+		{Username: "below_mid", Rating: 149},
+		{Username: "mid", Rating: 150},
+		{Username: "below_top", Rating: 179},
+		{Username: "top", Rating: 180},
+		{Username: "ceiling", Rating: 200},
+	}
+	s, err := NewStoreWithBounds(seeds, 100, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.tiers, err = parseTiers("Low:100, Mid:150, High:180", 100, 200); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		username     string
+		tier         string
+		next         string
+		pointsNeeded int
+	}{
+		{"floor", "Low", "Mid", 50},
+		{"below_mid", "Low", "Mid", 1},
+		{"mid", "Mid", "High", 30},
+		{"below_top", "Mid", "High", 1},
+		{"top", "High", "", 0},
+		{"ceiling", "High", "", 0},
+	}
+	for _, tt := range tests {
+		got, ok := s.UserTier(tt.username)
+		if !ok || got.Tier != tt.tier || got.NextTier != tt.next || got.PointsNeeded != tt.pointsNeeded {
+			t.Errorf("%s: got %+v, want tier %s, next %q, %d points", tt.username, got, tt.tier, tt.next, tt.pointsNeeded)
+		}
+	}
+
+	counts := s.TierCounts()
+	want := []TierCount{
+		{Tier{Name: "Low", MinRating: 100, MaxRating: 149}, 2},
+		{Tier{Name: "Mid", MinRating: 150, MaxRating: 179}, 2},
+		{Tier{Name: "High", MinRating: 180, MaxRating: 200}, 2},
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("got %d tiers, want %d", len(counts), len(want))
+	}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Errorf("tier %d: got %+v, want %+v", i, counts[i], want[i])
+		}
+	}
+}
+
+func TestParseTiersRejects(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", "no tiers configured"},
+		{"Low:150,High:180", "first tier must start at 100"},
+		{"Low:100,High:250", `tier "High" min rating 250 is outside 100-200`},
+		{"Low:100,Mid:150,High:150", `tier "High" min rating 150 must be above 150`},
+		{"Low:100,High:120,Mid:110", `tier "Mid" min rating 110 must be above 120`},
+		{"Low:100,High", `tier "High" must be name:min_rating`},
+		{"Low:100,High:top", `tier "High" has invalid min rating`},
+	}
+	for _, tt := range tests {
+		if _, err := parseTiers(tt.raw, 100, 200); err == nil || err.Error() != tt.want {
+			t.Errorf("parseTiers(%q): error %v, want %q", tt.raw, err, tt.want)
+		}
+	}
+}
+
+func TestTierRoutes(t *testing.T) {
+	a := newTestApp(t, []SeedUser{{Username: "silver_floor", Rating: 1000}, {Username: "bronze_ceiling", Rating: 999}}, nil)
+	rec := serve(a, http.MethodGet, "/users/bronze_ceiling/tier", "", nil)
+	var userTier UserTier
+	if err := json.Unmarshal(rec.Body.Bytes(), &userTier); err != nil {
+		t.Fatal(err)
+	}
+	if want := (UserTier{Username: "bronze_ceiling", Rating: 999, Tier: "Bronze", NextTier: "Silver", NextTierRating: 1000, PointsNeeded: 1}); userTier != want {
+		t.Fatalf("got %+v, want %+v", userTier, want)
+	}
+	if rec := serve(a, http.MethodGet, "/users/nobody/tier", "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown user: got %d, want 404", rec.Code)
+	}
+
+	var body TiersResponse
+	if err := json.Unmarshal(serve(a, http.MethodGet, "/stats/tiers", "", nil).Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tier := range body.Tiers {
+		if (tier.Name == "Bronze" || tier.Name == "Silver") != (tier.Users == 1) {
+			t.Errorf("%s holds %d users", tier.Name, tier.Users)
+		}
+		names = append(names, tier.Name)
+	}
+	if got := strings.Join(names, ","); got != "Bronze,Silver,Gold,Platinum,Diamond" {
+		t.Fatalf("tiers %s", got)
+	}
+}
@@ -0,0 +1,61 @@
+package leaderboard
+
+import (
+	"sync"
+	"time"
+)
+
+// timingWindow is how many recent measurements the rolling averages cover.
+const timingWindow = 16
+
+// durationWindow keeps the latest timingWindow samples of one duration.
+type durationWindow struct {
+	mu      sync.Mutex
+	samples [timingWindow]time.Duration
+	next    int
+	count   int
+}
+
+func (d *durationWindow) record(value time.Duration) {
+	d.mu.Lock()
+	d.samples[d.next] = value
+	d.next = (d.next + 1) % timingWindow
+	if d.count < timingWindow {
+		d.count++
+	}
+	d.mu.Unlock()
+}
+
+// stats returns the latest sample and the mean of the window, both 0 before
+// anything is recorded.
+func (d *durationWindow) stats() (time.Duration, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.count == 0 {
+		return 0, 0
+	}
+	var sum time.Duration
+	for i := 0; i < d.count; i++ {
+		sum += d.samples[i]
+	}
+	last := d.samples[(d.next-1+timingWindow)%timingWindow]
+	return last, sum / time.Duration(d.count)
+}
+
+// Timings reports how long snapshot builds and rating updates take, to
+// show whether snapshotting keeps up with the update rate. Update latency
+// and rate cover the random update loop, timed per batch.
+func (s *Store) Timings() Timings {
+	lastBuild, avgBuild := s.buildTimes.stats()
+	_, avgUpdate := s.updateTimes.stats()
+	return Timings{
+		LastSnapshotBuildMs: durationMs(lastBuild),
+		AvgSnapshotBuildMs:  durationMs(avgBuild),
+		AvgUpdateLatencyUs:  float64(avgUpdate.Nanoseconds()) / 1000,
+		UpdatesPerSecond:    s.updateRate.Rate(time.Now(), s.createdAt),
+	}
+}
+
+func durationMs(value time.Duration) float64 {
+	return float64(value.Microseconds()) / 1000
+}
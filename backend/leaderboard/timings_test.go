@@ -0,0 +1,83 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDurationWindow(t *testing.T) {
+	var window durationWindow
+	if last, avg := window.stats(); last != 0 || avg != 0 {
+		t.Fatalf("empty window: last %v, avg %v", last, avg)
+	}
+	window.record(2 * time.Millisecond)
+	window.record(4 * time.Millisecond)
+	if last, avg := window.stats(); last != 4*time.Millisecond || avg != 3*time.Millisecond {
+		t.Fatalf("two samples: last %v, avg %v; want 4ms, 3ms", last, avg)
+	}
+	// Once full, the oldest samples drop out of the average.
+	for i := 0; i < timingWindow; i++ {
+		window.record(10 * time.Millisecond)
+	}
+	window.record(26 * time.Millisecond)
+	if last, avg := window.stats(); last != 26*time.Millisecond || avg != 11*time.Millisecond {
+		t.Fatalf("full window: last %v, avg %v; want 26ms, 11ms", last, avg)
+	}
+}
+
+func TestRateCounterAveragesCompletedSeconds(t *testing.T) {
+	var counter rateCounter
+	start := time.Unix(1_700_000_000, 0)
+	counter.AddN(start, 30)
+	counter.AddN(start.Add(time.Second), 10)
+	counter.AddN(start.Add(2*time.Second), 99)
+	// The current second is still filling, so it is left out.
+	if got := counter.Rate(start.Add(2*time.Second), start); got != 20 {
+		t.Fatalf("rate after 2s = %v, want 20", got)
+	}
+	if got := counter.Rate(start.Add(time.Duration(rateWindowSeconds+5)*time.Second), start); got != 0 {
+		t.Fatalf("rate once every sample aged out = %v, want 0", got)
+	}
+	if counter.Total() != 139 {
+		t.Fatalf("total %d, want 139", counter.Total())
+	}
+}
+
+func TestTimingsPopulatedAfterWork(t *testing.T) {
+	s, err := NewStore(randomSeeds(20000, defaultMinRating, defaultMaxRating, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Timings(); got.LastSnapshotBuildMs != 0 || got.AvgSnapshotBuildMs != 0 || got.AvgUpdateLatencyUs != 0 {
+		t.Fatalf("timings before any work: %+v", got)
+	}
+
+	source := newRand(1)
+	for i := 0; i < 3; i++ {
+		s.randomTick(source, 500, 50)
+		s.RefreshSnapshot()
+	}
+	got := s.Timings()
+	if got.LastSnapshotBuildMs <= 0 || got.AvgSnapshotBuildMs <= 0 || got.AvgUpdateLatencyUs <= 0 {
+		t.Fatalf("timings after 3 refreshes and updates: %+v", got)
+	}
+	if _, avg := s.buildTimes.stats(); durationMs(avg) != got.AvgSnapshotBuildMs {
+		t.Fatalf("avg_snapshot_build_ms %v does not match the window %v", got.AvgSnapshotBuildMs, avg)
+	}
+	if s.updateRate.Total() == 0 {
+		t.Fatal("no updates were counted towards updates_per_second")
+	}
+
+	a := newTestApp(t, testSeeds(50), nil)
+	var summary map[string]any
+	if err := json.Unmarshal(serve(a, http.MethodGet, "/metrics/summary", "", nil).Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"last_snapshot_build_ms", "avg_snapshot_build_ms", "avg_update_latency_us", "updates_per_second"} {
+		if _, ok := summary[key].(float64); !ok {
+			t.Errorf("/metrics/summary %s = %v, want a number", key, summary[key])
+		}
+	}
+}
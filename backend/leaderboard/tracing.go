@@ -0,0 +1,122 @@
+package leaderboard
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName           = "matiks_app/backend"
+	defaultTraceService  = "leaderboard-backend"
+	traceShutdownTimeout = 5 * time.Second
+)
+
+// tracer owns the OpenTelemetry provider the spans are exported through.
+// A nil tracer traces nothing.
+type tracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	logger     *slog.Logger
+}
+
+// newTracerFromEnv returns a tracer exporting over OTLP/HTTP, or nil when no
+// OTLP endpoint is set or OTEL_TRACES_EXPORTER is none. The exporter reads
+// the endpoint, headers and timeout from the standard OTEL_EXPORTER_OTLP_*
+// variables itself. Setup and export failures are logged to logger.
+func newTracerFromEnv(logger *slog.Logger) *tracer {
+	if strings.EqualFold(getEnvString("OTEL_TRACES_EXPORTER", "otlp"), "none") {
+		return nil
+	}
+	if getEnvString("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "") == "" && getEnvString("OTEL_EXPORTER_OTLP_ENDPOINT", "") == "" {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		logger.Warn("tracing disabled", "error", err)
+		return nil
+	}
+	service := attribute.String("service.name", getEnvString("OTEL_SERVICE_NAME", defaultTraceService))
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(service)),
+	)
+	return &tracer{
+		provider:   provider,
+		tracer:     provider.Tracer(tracerName),
+		propagator: propagation.TraceContext{},
+		logger:     logger,
+	}
+}
+
+// Run waits for ctx to end, then flushes the spans still queued and stops
+// the exporter.
+func (t *tracer) Run(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+	defer cancel()
+	if err := t.provider.Shutdown(shutdownCtx); err != nil {
+		t.logger.Warn("trace export failed", "error", err)
+	}
+}
+
+// withTracing wraps each request in a server span, continuing the trace of
+// an incoming W3C traceparent header. The span is named after the matched
+// route pattern, not the path, so names stay bounded.
+func (a *app) withTracing(t *tracer, next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		attributes := []attribute.KeyValue{attribute.String("http.method", r.Method)}
+		name := r.Method
+		if route := a.routePattern(r); route != "" {
+			// Patterns such as "GET /compare" carry their own method.
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+			attributes = append(attributes, attribute.String("http.route", route))
+			name += " " + route
+		}
+		for _, key := range []string{"page", "limit"} {
+			if raw := r.URL.Query().Get(key); raw != "" {
+				if value, err := strconv.Atoi(raw); err == nil {
+					attributes = append(attributes, attribute.Int("leaderboard."+key, value))
+				}
+			}
+		}
+		ctx, span := t.tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attributes...),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package leaderboard
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newRecordingTracer returns a tracer whose spans land in the returned
+// exporter as soon as they end.
+func newRecordingTracer(t *testing.T) (*tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return &tracer{provider: provider, tracer: provider.Tracer(tracerName), propagator: propagation.TraceContext{}}, exporter
+}
+
+func TestTracerDisabledWithoutEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if newTracerFromEnv(slog.Default()) != nil {
+		t.Fatal("tracer built without an OTLP endpoint")
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:4318")
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+	if newTracerFromEnv(slog.Default()) != nil {
+		t.Fatal("tracer built with OTEL_TRACES_EXPORTER=none")
+	}
+}
+
+func TestWithTracingContinuesIncomingTrace(t *testing.T) {
+	tr, exporter := newRecordingTracer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/{username}", func(w http.ResponseWriter, r *http.Request) {
+		if !trace.SpanContextFromContext(r.Context()).IsValid() {
+			t.Error("handler context carries no span")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("GET /compare", func(w http.ResponseWriter, r *http.Request) {})
+	a := &app{mux: mux}
+	handler := a.withTracing(tr, mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/user/rahul?page=2&limit=50", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("traceparent"); got != "" {
+		t.Fatalf("response carries a traceparent header %q", got)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/user/priya", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/compare?a=x&b=y", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/no/such/route", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("exported %d spans, want 4", len(spans))
+	}
+	span := spans[0]
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("span trace %s parent %s does not continue the incoming trace", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+	if span.SpanKind != trace.SpanKindServer || span.Status.Code != codes.Error {
+		t.Fatalf("span kind %v status %v", span.SpanKind, span.Status.Code)
+	}
+	got := attribute.NewSet(span.Attributes...)
+	for _, want := range []attribute.KeyValue{
+		attribute.String("http.route", "/user/{username}"),
+		attribute.Int("leaderboard.page", 2),
+		attribute.Int("leaderboard.limit", 50),
+		attribute.Int("http.status_code", http.StatusServiceUnavailable),
+	} {
+		if value, ok := got.Value(want.Key); !ok || value != want.Value {
+			t.Errorf("attribute %s = %v, want %v", want.Key, value.Emit(), want.Value.Emit())
+		}
+	}
+
+	// Different usernames share one span name, and patterns that carry a
+	// method are not prefixed with it twice.
+	for i, want := range []string{"GET /user/{username}", "GET /user/{username}", "GET /compare", "GET"} {
+		if spans[i].Name != want {
+			t.Errorf("span %d named %q, want %q", i, spans[i].Name, want)
+		}
+	}
+	unmatched := attribute.NewSet(spans[3].Attributes...)
+	if _, ok := unmatched.Value("http.route"); ok {
+		t.Error("an unmatched request was given a route")
+	}
+}
+
+func TestSnapshotBuildIsTraced(t *testing.T) {
+	tr, exporter := newRecordingTracer(t)
+	s, err := NewStore(testSeeds(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.tracer = tr
+	s.RefreshSnapshot()
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "snapshot.build" {
+		t.Fatalf("exported %v, want one snapshot.build span", spans)
+	}
+	attributes := attribute.NewSet(spans[0].Attributes...)
+	if value, ok := attributes.Value("snapshot.users"); !ok || value.AsInt64() != 5 {
+		t.Fatalf("snapshot.users = %v, want 5", value.Emit())
+	}
+}
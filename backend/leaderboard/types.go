@@ -0,0 +1,378 @@
+package leaderboard
+
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+	// Percentile is only set on request, as a pointer so a bottom-ranked
+	// 0 is still sent while unrequested values are left out.
+	Percentile *float64 `json:"percentile,omitempty"`
+	// Above and Below are the users directly ahead of and behind this one
+	// on the board, set by /search?context=1.
+	Above *LeaderboardEntry `json:"above,omitempty"`
+	Below *LeaderboardEntry `json:"below,omitempty"`
+}
+
+type LeaderboardResponse struct {
+	UpdatedAt  string `json:"updated_at"`
+	TotalUsers int    `json:"total_users"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	TotalPages int    `json:"total_pages"`
+	PageNav
+	Entries    []LeaderboardEntry `json:"entries"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// PageNav is the navigation state for a clamped page. With no pages at all
+// both page numbers are 0 and neither direction is available.
+type PageNav struct {
+	HasPrev   bool `json:"has_prev"`
+	HasNext   bool `json:"has_next"`
+	FirstPage int  `json:"first_page"`
+	LastPage  int  `json:"last_page"`
+}
+
+type LeaderboardCursorResponse struct {
+	UpdatedAt  string             `json:"updated_at"`
+	Version    uint64             `json:"version"`
+	PageSize   int                `json:"page_size"`
+	Entries    []LeaderboardEntry `json:"entries"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+type LeaderboardEvent struct {
+	Version    uint64             `json:"version"`
+	UpdatedAt  string             `json:"updated_at"`
+	TotalUsers int                `json:"total_users"`
+	Entries    []LeaderboardEntry `json:"entries"`
+}
+
+type TopResponse struct {
+	UpdatedAt string             `json:"updated_at"`
+	N         int                `json:"n"`
+	Entries   []LeaderboardEntry `json:"entries"`
+}
+
+type RankRangeResponse struct {
+	UpdatedAt  string             `json:"updated_at"`
+	From       int                `json:"from"`
+	To         int                `json:"to"`
+	TotalUsers int                `json:"total_users"`
+	Entries    []LeaderboardEntry `json:"entries"`
+}
+
+type UsersAtRatingResponse struct {
+	Rating     int `json:"rating"`
+	Total      int `json:"total"`
+	Page       int `json:"page"`
+	PageSize   int `json:"page_size"`
+	TotalPages int `json:"total_pages"`
+	PageNav
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+type LeaderboardRangeResponse struct {
+	UpdatedAt  string             `json:"updated_at"`
+	Min        int                `json:"min"`
+	Max        int                `json:"max"`
+	Total      int                `json:"total"`
+	Page       int                `json:"page"`
+	PageSize   int                `json:"page_size"`
+	TotalPages int                `json:"total_pages"`
+	Entries    []LeaderboardEntry `json:"entries"`
+}
+
+type GroupLeaderboard struct {
+	Group   string             `json:"group"`
+	Members int                `json:"members"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+type GroupedLeaderboardResponse struct {
+	UpdatedAt string             `json:"updated_at"`
+	Top       int                `json:"top"`
+	Groups    []GroupLeaderboard `json:"groups"`
+}
+
+type TopChange struct {
+	Username string `json:"username"`
+	Change   string `json:"change"`
+	OldRank  int    `json:"old_rank"`
+	NewRank  int    `json:"new_rank"`
+}
+
+type TopChangesResponse struct {
+	Version  uint64      `json:"version"`
+	Since    uint64      `json:"since"`
+	N        int         `json:"n"`
+	Baseline bool        `json:"baseline"`
+	Changes  []TopChange `json:"changes"`
+}
+
+type LeaderboardDeltaResponse struct {
+	Version    uint64             `json:"version"`
+	Since      uint64             `json:"since"`
+	N          int                `json:"n"`
+	FullReload bool               `json:"full_reload"`
+	Changed    []LeaderboardEntry `json:"changed"`
+	Removed    []string           `json:"removed"`
+}
+
+type TiersResponse struct {
+	Tiers []TierCount `json:"tiers"`
+	User  *UserTier   `json:"user,omitempty"`
+}
+
+type EntryResponse struct {
+	Version  uint64           `json:"version"`
+	Position int              `json:"position"`
+	Total    int              `json:"total"`
+	Entry    LeaderboardEntry `json:"entry"`
+}
+
+type AroundResponse struct {
+	Username string             `json:"username"`
+	Radius   int                `json:"radius"`
+	Center   int                `json:"center"`
+	Entries  []LeaderboardEntry `json:"entries"`
+}
+
+type UserResponse struct {
+	LeaderboardEntry
+	Percentile float64 `json:"percentile"`
+	PeakRating int     `json:"peak_rating"`
+}
+
+type CompareResult struct {
+	A          LeaderboardEntry `json:"a"`
+	B          LeaderboardEntry `json:"b"`
+	RatingDiff int              `json:"rating_diff"`
+	RankDiff   int              `json:"rank_diff"`
+}
+
+type UserPercentile struct {
+	Username   string  `json:"username"`
+	Rating     int     `json:"rating"`
+	Percentile float64 `json:"percentile"`
+}
+
+type UserPeak struct {
+	Username   string `json:"username"`
+	Rating     int    `json:"rating"`
+	PeakRating int    `json:"peak_rating"`
+}
+
+type PrefixCount struct {
+	Prefix string `json:"prefix"`
+	Count  int    `json:"count"`
+}
+
+type PrefixesResponse struct {
+	Length   int           `json:"len"`
+	Top      int           `json:"top"`
+	Prefixes []PrefixCount `json:"prefixes"`
+}
+
+type CombinedSearchResponse struct {
+	Query  string             `json:"query"`
+	Exact  []LeaderboardEntry `json:"exact"`
+	Prefix []LeaderboardEntry `json:"prefix"`
+	Fuzzy  []LeaderboardEntry `json:"fuzzy"`
+}
+
+type RankedEntry struct {
+	RequestedRank int `json:"requested_rank"`
+	LeaderboardEntry
+}
+
+type EntriesByRankRequest struct {
+	Ranks []int `json:"ranks"`
+}
+
+type EntriesByRankResponse struct {
+	Version uint64        `json:"version"`
+	Entries []RankedEntry `json:"entries"`
+}
+
+type UserRank struct {
+	Username string `json:"username"`
+	Rank     int    `json:"rank,omitempty"`
+	Rating   int    `json:"rating,omitempty"`
+	Found    bool   `json:"found"`
+}
+
+type UserRanksRequest struct {
+	Usernames []string `json:"usernames"`
+}
+
+type UserRanksResponse struct {
+	Results []UserRank `json:"results"`
+}
+
+type AddUserRequest struct {
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+	Group    string `json:"group,omitempty"`
+}
+
+type SetRatingRequest struct {
+	Rating *int `json:"rating"`
+}
+
+type SetRatingResponse struct {
+	LeaderboardEntry
+	DryRun bool `json:"dry_run"`
+}
+
+type RatingChange struct {
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+}
+
+// SetResult is the outcome of one RatingChange. Applied is false for
+// unknown users, rejected ratings and ratings the user already had. Rank
+// and Rating are the user's once the whole batch is applied.
+type SetResult struct {
+	Username string `json:"username"`
+	Found    bool   `json:"found"`
+	Clamped  bool   `json:"clamped"`
+	Applied  bool   `json:"applied"`
+	Rank     int    `json:"rank,omitempty"`
+	Rating   int    `json:"rating,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type SetRatingsResponse struct {
+	Applied int         `json:"applied"`
+	DryRun  bool        `json:"dry_run"`
+	Results []SetResult `json:"results"`
+}
+
+type UsernameValidation struct {
+	Username  string `json:"username"`
+	Valid     bool   `json:"valid"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type RankMismatch struct {
+	Position       int    `json:"position"`
+	Username       string `json:"username"`
+	SnapshotRank   int    `json:"snapshot_rank"`
+	SnapshotRating int    `json:"snapshot_rating"`
+	LiveRank       int    `json:"live_rank"`
+	LiveRating     int    `json:"live_rating"`
+	Drift          int    `json:"drift"`
+}
+
+type ConsistencyReport struct {
+	Version    uint64         `json:"version"`
+	Offset     int            `json:"offset"`
+	Tolerance  int            `json:"tolerance"`
+	Checked    int            `json:"checked"`
+	MaxDrift   int            `json:"max_drift"`
+	Mismatches []RankMismatch `json:"mismatches"`
+}
+
+// SearchRequest is the body of POST /search.
+type SearchRequest struct {
+	Query string `json:"query"`
+	Mode  string `json:"mode"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+}
+
+type SearchResponse struct {
+	Query      string `json:"query"`
+	Mode       string `json:"mode"`
+	Count      int    `json:"count"`
+	Total      int    `json:"total"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	TotalPages int    `json:"total_pages"`
+	PageNav
+	Truncated bool               `json:"truncated,omitempty"`
+	Results   []LeaderboardEntry `json:"results"`
+}
+
+type MetricsSummary struct {
+	StartedAt           string  `json:"started_at"`
+	UptimeSeconds       float64 `json:"uptime_seconds"`
+	RatingUpdatesTotal  uint64  `json:"rating_updates_total"`
+	SnapshotsBuiltTotal uint64  `json:"snapshots_built_total"`
+	RequestsTotal       uint64  `json:"requests_total"`
+	RequestsPerSecond   float64 `json:"requests_per_second"`
+	Timings
+}
+
+type Timings struct {
+	LastSnapshotBuildMs float64 `json:"last_snapshot_build_ms"`
+	AvgSnapshotBuildMs  float64 `json:"avg_snapshot_build_ms"`
+	AvgUpdateLatencyUs  float64 `json:"avg_update_latency_us"`
+	UpdatesPerSecond    float64 `json:"updates_per_second"`
+}
+
+type HealthResponse struct {
+	Status         string `json:"status"`
+	Users          int    `json:"users"`
+	SnapshotAgeMs  int64  `json:"snapshot_age_ms"`
+	UpdatesEnabled bool   `json:"updates_enabled"`
+}
+
+type StatusResponse struct {
+	Status          string `json:"status"`
+	Maintenance     bool   `json:"maintenance"`
+	SnapshotsPaused bool   `json:"snapshots_paused"`
+	TotalUsers      int    `json:"total_users"`
+	SnapshotVersion uint64 `json:"snapshot_version"`
+	UpdatedAt       string `json:"updated_at"`
+}
+
+type WatchRequest struct {
+	Threshold *int   `json:"threshold"`
+	URL       string `json:"url"`
+}
+
+type WatchesResponse struct {
+	Watches []Watch `json:"watches"`
+	Dropped uint64  `json:"dropped"`
+}
+
+type toggleRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type Stats struct {
+	TotalUsers   int64   `json:"total_users"`
+	MinRating    int     `json:"min_rating"`
+	MaxRating    int     `json:"max_rating"`
+	MeanRating   float64 `json:"mean_rating"`
+	MedianRating float64 `json:"median_rating"`
+	UpdatedAt    string  `json:"updated_at"`
+}
+
+type MoverEntry struct {
+	Username  string `json:"username"`
+	OldRating int    `json:"old_rating"`
+	NewRating int    `json:"new_rating"`
+	Delta     int    `json:"delta"`
+}
+
+type MoversResponse struct {
+	Direction string       `json:"direction"`
+	Window    int          `json:"window"`
+	Movers    []MoverEntry `json:"movers"`
+}
+
+type HistogramBin struct {
+	Min   int   `json:"min"`
+	Max   int   `json:"max"`
+	Count int64 `json:"count"`
+}
+
+type HistogramResponse struct {
+	Buckets    int            `json:"buckets"`
+	TotalUsers int            `json:"total_users"`
+	Bins       []HistogramBin `json:"bins"`
+}
@@ -0,0 +1,28 @@
+package leaderboard
+
+import "runtime"
+
+// Set at build time, for example:
+//
+//	go build -ldflags "-X matiks_app/backend/leaderboard.version=1.4.0 -X matiks_app/backend/leaderboard.commit=$(git rev-parse --short HEAD) -X matiks_app/backend/leaderboard.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+var (
+	version   = "dev"
+	commit    = "dev"
+	buildTime = "dev"
+)
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+func NewBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+}
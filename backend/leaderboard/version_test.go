@@ -0,0 +1,46 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	a := newTestApp(t, testSeeds(3), nil)
+	rec := serve(a, http.MethodGet, "/version", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(body))
+	for key := range body {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if want := []string{"build_time", "commit", "go_version", "version"}; !slices.Equal(keys, want) {
+		t.Fatalf("keys %v, want %v", keys, want)
+	}
+	if body["go_version"] == "" || body["go_version"] != runtime.Version() {
+		t.Fatalf("go_version %q, want %q", body["go_version"], runtime.Version())
+	}
+	for _, key := range []string{"version", "commit", "build_time"} {
+		if body[key] != "dev" {
+			t.Fatalf("%s = %q, want the dev default", key, body[key])
+		}
+	}
+}
+
+func TestNewBuildInfoReadsLinkerVars(t *testing.T) {
+	defer func(v, c, b string) { version, commit, buildTime = v, c, b }(version, commit, buildTime)
+	version, commit, buildTime = "1.4.0", "abc1234", "2026-01-02T03:04:05Z"
+	want := BuildInfo{Version: "1.4.0", Commit: "abc1234", BuildTime: "2026-01-02T03:04:05Z", GoVersion: runtime.Version()}
+	if got := NewBuildInfo(); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+package leaderboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxWatches        = 100
+	webhookQueueSize  = 1024
+	webhookAttempts   = 3
+	webhookTimeout    = 5 * time.Second
+	webhookRetryDelay = 500 * time.Millisecond
+)
+
+// Watch calls URL whenever a rating update moves a user across Threshold.
+type Watch struct {
+	ID        int    `json:"id"`
+	Threshold int    `json:"threshold"`
+	URL       string `json:"url"`
+}
+
+// ThresholdCrossing is the JSON body POSTed to a watch's URL. Direction is
+// "up" when the user reached Threshold from below and "down" when they fell
+// under it.
+type ThresholdCrossing struct {
+	WatchID   int    `json:"watch_id"`
+	Threshold int    `json:"threshold"`
+	Username  string `json:"username"`
+	OldRating int    `json:"old_rating"`
+	NewRating int    `json:"new_rating"`
+	Direction string `json:"direction"`
+	CrossedAt string `json:"crossed_at"`
+}
+
+type webhookDelivery struct {
+	url     string
+	payload ThresholdCrossing
+}
+
+// watchRegistry holds the threshold watches and the queue of crossings
+// waiting to be delivered. moveUser reads the watch list without locking and
+// never blocks on the queue: when it is full the crossing is dropped and
+// counted, so a slow webhook target cannot stall rating updates.
+type watchRegistry struct {
+	mu      sync.Mutex
+	nextID  int
+	watches atomic.Pointer[[]Watch]
+	queue   chan webhookDelivery
+	dropped atomic.Uint64
+	client  *http.Client
+}
+
+func newWatchRegistry() *watchRegistry {
+	return &watchRegistry{
+		queue:  make(chan webhookDelivery, webhookQueueSize),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// observe queues a delivery for every watch whose threshold lies between
+// oldRating and newRating. Reaching the threshold counts as crossing it.
+func (r *watchRegistry) observe(username string, oldRating int, newRating int) {
+	watches := r.watches.Load()
+	if watches == nil {
+		return
+	}
+	var crossedAt string
+	for _, watch := range *watches {
+		direction := ""
+		switch {
+		case oldRating < watch.Threshold && newRating >= watch.Threshold:
+			direction = "up"
+		case newRating < watch.Threshold && oldRating >= watch.Threshold:
+			direction = "down"
+		default:
+			continue
+		}
+		if crossedAt == "" {
+			crossedAt = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		delivery := webhookDelivery{url: watch.URL, payload: ThresholdCrossing{
+			WatchID:   watch.ID,
+			Threshold: watch.Threshold,
+			Username:  username,
+			OldRating: oldRating,
+			NewRating: newRating,
+			Direction: direction,
+			CrossedAt: crossedAt,
+		}}
+		select {
+		case r.queue <- delivery:
+		default:
+			r.dropped.Add(1)
+		}
+	}
+}
+
+// AddWatch registers a webhook for crossings of threshold, which must lie
+// inside the rating bounds. target must be an absolute http or https URL.
+func (s *Store) AddWatch(threshold int, target string) (Watch, error) {
+	if threshold <= s.minRating || threshold > s.maxRating {
+		return Watch{}, fmt.Errorf("threshold must be in %d-%d", s.minRating+1, s.maxRating)
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Watch{}, errors.New("url must be an absolute http or https URL")
+	}
+
+	r := s.watches
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := r.list()
+	if len(current) >= maxWatches {
+		return Watch{}, fmt.Errorf("at most %d watches can be registered", maxWatches)
+	}
+	r.nextID++
+	watch := Watch{ID: r.nextID, Threshold: threshold, URL: parsed.String()}
+	next := append(current[:len(current):len(current)], watch)
+	r.watches.Store(&next)
+	return watch, nil
+}
+
+// RemoveWatch unregisters a watch. Crossings it already queued are still
+// delivered.
+func (s *Store) RemoveWatch(id int) bool {
+	r := s.watches
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := r.list()
+	for i, watch := range current {
+		if watch.ID == id {
+			next := make([]Watch, 0, len(current)-1)
+			next = append(next, current[:i]...)
+			next = append(next, current[i+1:]...)
+			r.watches.Store(&next)
+			return true
+		}
+	}
+	return false
+}
+
+// Watches lists the registered watches in the order they were added, and
+// how many crossings were dropped because the delivery queue was full.
+func (s *Store) Watches() ([]Watch, uint64) {
+	watches := s.watches.list()
+	if watches == nil {
+		watches = []Watch{}
+	}
+	return watches, s.watches.dropped.Load()
+}
+
+func (r *watchRegistry) list() []Watch {
+	if watches := r.watches.Load(); watches != nil {
+		return *watches
+	}
+	return nil
+}
+
+// RunWebhooks delivers queued crossings one at a time until ctx ends, so
+// the HTTP calls stay off the update path. Failed deliveries are logged to
+// logger.
+func (s *Store) RunWebhooks(ctx context.Context, logger *slog.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery := <-s.watches.queue:
+			if err := s.watches.deliver(ctx, delivery); err != nil {
+				logger.Warn("webhook delivery failed", "watch_id", delivery.payload.WatchID, "error", err)
+			}
+		}
+	}
+}
+
+// deliver POSTs one crossing, retrying up to webhookAttempts times with a
+// doubling delay until the target answers 2xx.
+func (r *watchRegistry) deliver(ctx context.Context, delivery webhookDelivery) error {
+	body, err := json.Marshal(delivery.payload)
+	if err != nil {
+		return err
+	}
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = r.post(ctx, delivery.url, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (r *watchRegistry) post(ctx context.Context, target string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", target, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliversCrossings(t *testing.T) {
+	received := make(chan ThresholdCrossing, 4)
+	var requests atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first delivery fails once, so it only arrives on the retry.
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var crossing ThresholdCrossing
+		if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&crossing) != nil {
+			t.Errorf("webhook body is not JSON: Content-Type %q", r.Header.Get("Content-Type"))
+		}
+		received <- crossing
+	}))
+	defer receiver.Close()
+
+	s, err := NewStoreWithBounds([]SeedUser{{Username: "climber", Rating: 200}}, 100, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watch, err := s.AddWatch(250, receiver.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.RunWebhooks(ctx, slog.Default())
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	next := func() ThresholdCrossing {
+		t.Helper()
+		select {
+		case crossing := <-received:
+			return crossing
+		case <-time.After(5 * time.Second):
+			t.Fatal("no webhook arrived")
+			return ThresholdCrossing{}
+		}
+	}
+	for _, step := range []struct {
+		rating    int
+		direction string
+	}{
+		{240, ""},
+		{250, "up"},
+		{300, ""},
+		{249, "down"},
+	} {
+		if _, err := s.SetRatingByUsername("climber", step.rating); err != nil {
+			t.Fatal(err)
+		}
+		if step.direction == "" {
+			continue
+		}
+		crossing := next()
+		if crossing.WatchID != watch.ID || crossing.Username != "climber" || crossing.NewRating != step.rating || crossing.Direction != step.direction {
+			t.Fatalf("crossing to %d: got %+v, want direction %s", step.rating, crossing, step.direction)
+		}
+	}
+	select {
+	case crossing := <-received:
+		t.Fatalf("unexpected extra webhook %+v", crossing)
+	default:
+	}
+	if got := requests.Load(); got != 3 {
+		t.Fatalf("receiver saw %d requests, want 3 with one retry", got)
+	}
+}
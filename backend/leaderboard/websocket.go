@@ -0,0 +1,85 @@
+package leaderboard
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsPingInterval = 15 * time.Second
+	wsPongWait     = 2 * wsPingInterval
+	wsWriteWait    = 5 * time.Second
+)
+
+// serveLeaderboardWS is the WebSocket counterpart of streamLeaderboard: a
+// LeaderboardEvent text frame on connect and after every snapshot refresh,
+// fed from the same subscriber registry. The server pings periodically and
+// drops the connection when pongs stop arriving. Origins are checked against
+// the CORS allow-list when one is configured.
+func (a *app) serveLeaderboardWS(w http.ResponseWriter, r *http.Request, n int) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			if len(a.corsOrigins) == 0 {
+				return true
+			}
+			_, ok := a.corsOrigins[r.Header.Get("Origin")]
+			return ok
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	updates, cancel := a.store.Subscribe()
+	defer cancel()
+
+	// Clients only send pongs and close frames; the reader exists to
+	// process them and notice when the peer goes away.
+	closed := make(chan struct{})
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func() error {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(a.store.leaderboardEvent(n))
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	if send() != nil {
+		return
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case <-a.done:
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(wsWriteWait))
+			return
+		case <-updates:
+			if send() != nil {
+				return
+			}
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)) != nil {
+				return
+			}
+		}
+	}
+}
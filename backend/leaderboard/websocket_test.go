@@ -0,0 +1,51 @@
+package leaderboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLeaderboardWebSocket(t *testing.T) {
+	a := newTestApp(t, testSeeds(10), func(cfg *Config) { cfg.CORSOrigins = []string{"https://app.example.com"} })
+	srv := httptest.NewServer(a.handler)
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?n=3"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}}); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("dial from a disallowed origin: err %v, response %v; want a 403", err, resp)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://app.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	read := func() LeaderboardEvent {
+		t.Helper()
+		var event LeaderboardEvent
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+
+	first := read()
+	if first.TotalUsers != 10 || len(first.Entries) != 3 || first.Entries[0].Username != "user_000" {
+		t.Fatalf("first frame: %d users, entries %+v; want 10 users led by user_000", first.TotalUsers, first.Entries)
+	}
+
+	if _, err := a.store.SetRatingByUsername("user_009", 4500); err != nil {
+		t.Fatal(err)
+	}
+	a.store.RefreshSnapshot()
+	next := read()
+	if next.Version <= first.Version || next.Entries[0].Username != "user_009" {
+		t.Fatalf("frame after a refresh: version %d (was %d), leader %q; want a newer version led by user_009", next.Version, first.Version, next.Entries[0].Username)
+	}
+}